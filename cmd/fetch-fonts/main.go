@@ -0,0 +1,109 @@
+// Command fetch-fonts downloads the Material Symbols variable fonts, their
+// codepoints tables and their license (Apache-2.0) from the repository of
+// Google Fonts, to be shipped with the plugin.
+//
+//	go run ./cmd/fetch-fonts/ fonts
+//
+// With -codepoints, the codepoints table of the Outlined style is also
+// written to that path, to update the table embedded in the plugin.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+const baseURL = "https://raw.githubusercontent.com/google/material-design-icons/master/"
+
+var styles = []string{"Outlined", "Rounded", "Sharp"}
+
+func main() {
+	codepointsPath := flag.String("codepoints", "", "also write the codepoints table of the Outlined style to this path")
+	force := flag.Bool("force", false, "download files that already exist")
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Println("Usage: fetch-fonts [-codepoints path] [-force] <dir>")
+		os.Exit(2)
+	}
+	dir := flag.Arg(0)
+
+	files := map[string]string{ // key: path in the repository, value: file name
+		"LICENSE": "LICENSE",
+	}
+	for _, style := range styles {
+		name := "MaterialSymbols" + style + "[FILL,GRAD,opsz,wght]"
+		files["variablefont/"+name+".ttf"] = name + ".ttf"
+		files["variablefont/"+name+".codepoints"] = name + ".codepoints"
+	}
+	for src, name := range files {
+		dest := filepath.Join(dir, name)
+		if !*force && isFileExist(dest) {
+			fmt.Printf("Skipping %v: already exists\n", dest)
+			continue
+		}
+		if err := download(src, dest); err != nil {
+			fmt.Printf("Error downloading %v: %v\n", src, err)
+			os.Exit(1)
+		}
+		fmt.Printf("Downloaded %v\n", dest)
+	}
+
+	if *codepointsPath != "" {
+		src := filepath.Join(dir, "MaterialSymbolsOutlined[FILL,GRAD,opsz,wght].codepoints")
+		data, err := os.ReadFile(src)
+		if err != nil {
+			fmt.Printf("Error reading codepoints: %v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(*codepointsPath, data, 0644); err != nil {
+			fmt.Printf("Error writing codepoints: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Updated %v\n", *codepointsPath)
+	}
+}
+
+func download(src, dest string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	u = u.JoinPath(src)
+
+	resp, err := http.Get(u.String())
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status: %v", resp.Status)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	// a partial file would be taken for a font by the plugin
+	tmp, err := os.CreateTemp(filepath.Dir(dest), filepath.Base(dest)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), dest)
+}
+
+func isFileExist(p string) bool {
+	info, err := os.Stat(p)
+	return err == nil && !info.IsDir()
+}
@@ -11,7 +11,7 @@ import (
 func main() {
 	var (
 		exts = []string{".json", ".exe", ".png"}
-		dirs = []string{"layouts", "property_inspector"}
+		dirs = []string{"layouts", "property_inspector", "fonts"}
 	)
 
 	pluginName := os.Args[1]
@@ -12,6 +12,8 @@ require (
 	github.com/onyx-and-iris/voicemeeter/v2 v2.1.0
 	github.com/tdewolff/canvas v0.0.0-20241202004848-95f003d9bc50
 	github.com/tidwall/pretty v1.2.1
+	golang.org/x/image v0.23.0
+	golang.org/x/text v0.21.0
 )
 
 require (
@@ -28,11 +30,9 @@ require (
 	github.com/tdewolff/font v0.0.0-20241125190050-d899fdc808fc // indirect
 	github.com/tdewolff/minify/v2 v2.21.2 // indirect
 	github.com/tdewolff/parse/v2 v2.7.19 // indirect
-	golang.org/x/image v0.23.0 // indirect
 	golang.org/x/net v0.32.0 // indirect
 	golang.org/x/sync v0.10.0 // indirect
 	golang.org/x/sys v0.28.0 // indirect
-	golang.org/x/text v0.21.0 // indirect
 	nhooyr.io/websocket v1.8.17 // indirect
 	star-tex.org/x/tex v0.5.0 // indirect
 )
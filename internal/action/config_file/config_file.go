@@ -0,0 +1,314 @@
+package config_file
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/configfile"
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/resync"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID    = "jp.hrko.streamdeck.voicemeeter.config-file"
+	OperationLoad = "load"
+	OperationSave = "save"
+)
+
+var (
+	shownInstances                  *cmap.MapOf[string, instanceProperty]
+	willAppearOrSettingsChangedChan = make(chan struct {
+		actionContext string
+		settings      instanceSettings
+	}, 32)
+	autoSaveStopMap *cmap.MapOf[string, chan struct{}] // key: context of action instance
+	backupDir       string
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	Operation      string                             `json:"operation,omitempty"` // "load" | "save"
+	FilePath       string                             `json:"filePath,omitempty"`
+	AutoBackup     bool                               `json:"autoBackup,omitempty"`
+	BackupCount    string                             `json:"backupCount,omitempty"`
+	AutoSave       string                             `json:"autoSave,omitempty"` // interval in minutes, "0" to disable
+	IconFontParams graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePoint  string                             `json:"iconCodePoint,omitempty"`
+	BgColor        string                             `json:"bgColor,omitempty"`
+}
+
+// SetBackupDir sets the directory where timestamped backups are saved.
+func SetBackupDir(dir string) {
+	backupDir = dir
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		Operation:   OperationLoad,
+		FilePath:    "",
+		AutoBackup:  false,
+		BackupCount: "10",
+		AutoSave:    "0",
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePoint: "",
+		BgColor:       "#004162",
+	}
+}
+
+func (s *instanceSettings) backupCount() int {
+	n, err := strconv.Atoi(s.BackupCount)
+	if err != nil || n < 1 {
+		log.Printf("invalid backupCount: '%v'\n", s.BackupCount)
+		return 10
+	}
+	return n
+}
+
+// autoSaveInterval returns the interval of the periodic backups, or 0 if they
+// are disabled.
+func (s *instanceSettings) autoSaveInterval() (time.Duration, error) {
+	if s.AutoSave == "" {
+		return 0, nil
+	}
+	minutes, err := strconv.Atoi(s.AutoSave)
+	if err != nil || minutes < 0 {
+		return 0, fmt.Errorf("invalid autoSave: '%v'", s.AutoSave)
+	}
+	return time.Duration(minutes) * time.Minute, nil
+}
+
+func (s *instanceSettings) setImage(client *streamdeck.Client, actionContext string) error {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+	iconCodePoint := s.IconCodePoint
+	if iconCodePoint == "" {
+		switch s.Operation {
+		case OperationSave:
+			iconCodePoint = "e161" // save
+		default:
+			iconCodePoint = "e2c7" // folder_open
+		}
+	}
+
+	iconColor := color.White
+	borderColor := color.Transparent
+	bgColor, _ := colors.ParseHEX(s.BgColor)
+
+	iconSize := 36
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := offsetX
+	borderWidth := 0
+
+	svg, err := fontParams.RenderIconSVG(iconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColor, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+	if err := client.SetImage(ctx, streamdeck.ImageSvg(svg), streamdeck.HardwareAndSoftware, nil); err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// run performs the configured operation. With auto backup enabled, the
+// current configuration is saved as a timestamped backup first, so that a
+// load can be undone and every save leaves a history.
+func (s *instanceSettings) run(vm *voicemeeter.Remote) error {
+	if err := configfile.CheckPath(s.FilePath, s.Operation == OperationLoad); err != nil {
+		return err
+	}
+
+	if s.AutoBackup {
+		path, err := configfile.Backup(vm, backupDir, s.backupCount())
+		if err != nil {
+			log.Printf("error saving backup: %v\n", err)
+			return err
+		}
+		log.Printf("backup saved to '%v'\n", path)
+	}
+
+	switch s.Operation {
+	case OperationLoad:
+		if err := configfile.Load(vm, s.FilePath); err != nil {
+			return err
+		}
+		// Loading changes every parameter, so let other actions re-read them.
+		vm.Sync()
+		resync.Broadcast()
+		return nil
+
+	case OperationSave:
+		return configfile.Save(vm, s.FilePath)
+
+	default:
+		return fmt.Errorf("unknown operation: '%v'", s.Operation)
+	}
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	autoSaveStopMap = cmap.NewOf[string, chan struct{}]()
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		p.Settings.setImage(client, event.Context)
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		p.Settings.setImage(client, event.Context)
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		stopAutoSave(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		// saving waits for Voicemeeter to write the file
+		go func() {
+			if err := p.Settings.run(vm); err != nil {
+				errreport.Report(ctx, client, err)
+				return
+			}
+			errreport.Clear(ctx, client)
+			client.ShowOk(ctx)
+		}()
+		return nil
+	})
+
+	go func() {
+		for w := range willAppearOrSettingsChangedChan {
+			if !shownInstances.Has(w.actionContext) {
+				continue
+			}
+			startAutoSave(client, vm, w.actionContext, w.settings)
+		}
+	}()
+
+	return nil
+}
+
+// startAutoSave saves a timestamped backup at the interval of the settings
+// while the key is shown, replacing the previous schedule of the instance.
+func startAutoSave(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string, settings instanceSettings) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	stopAutoSave(actionContext)
+	interval, err := settings.autoSaveInterval()
+	if err != nil {
+		errreport.Report(ctx, client, err)
+		return
+	}
+	if interval == 0 {
+		return
+	}
+
+	stop := make(chan struct{})
+	autoSaveStopMap.Set(actionContext, stop)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+				path, err := configfile.Backup(vm, backupDir, settings.backupCount())
+				if err != nil {
+					errreport.Report(ctx, client, fmt.Errorf("error saving backup: %w", err))
+					continue
+				}
+				log.Printf("backup saved to '%v'\n", path)
+			}
+		}
+	}()
+}
+
+func stopAutoSave(actionContext string) {
+	if stop, ok := autoSaveStopMap.Pop(actionContext); ok {
+		close(stop)
+	}
+}
@@ -0,0 +1,404 @@
+package device_select
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fufuok/cmap"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/device"
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/resync"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmevent"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID = "jp.hrko.streamdeck.voicemeeter.device-select"
+
+	// Voicemeeter has no notification for device changes, so the lists
+	// are polled.
+	deviceRefreshInterval = 3 * time.Second
+)
+
+var (
+	shownInstances                  *cmap.MapOf[string, instanceProperty]
+	willAppearOrSettingsChangedChan = make(chan struct {
+		actionContext string
+		settings      instanceSettings
+	}, 32)
+	cursorMap *cmap.MapOf[string, int] // key: context of action instance, value: index in the device list
+	renderCh  chan *renderParams
+
+	deviceListMu sync.Mutex
+	deviceLists  = map[string][]device.Device{} // key: "Strip" | "Bus"
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	StripOrBusKind  string                             `json:"stripOrBusKind,omitempty"` // "Strip" | "Bus"
+	StripOrBusIndex int                                `json:"stripOrBusIndex,omitempty"`
+	Driver          string                             `json:"driver,omitempty"` // "" (all) | "wdm" | "ks" | "mme" | "asio"
+	IconFontParams  graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePoint   string                             `json:"iconCodePoint,omitempty"`
+}
+
+type renderParams struct {
+	targetContext string
+	settings      instanceSettings
+	assigned      string
+	devices       []device.Device
+	cursor        int
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		StripOrBusKind:  "Strip",
+		StripOrBusIndex: 0,
+		Driver:          device.DriverWdm,
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePoint: "",
+	}
+}
+
+// devices returns the cached device list for the settings.
+func (s *instanceSettings) devices() []device.Device {
+	deviceListMu.Lock()
+	all := deviceLists[s.StripOrBusKind]
+	deviceListMu.Unlock()
+
+	if s.Driver == "" {
+		return all
+	}
+	devices := []device.Device{}
+	for _, d := range all {
+		if d.Type == s.Driver {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+// refreshDeviceLists reloads the device lists and reports whether any of
+// them changed.
+func refreshDeviceLists(vm *voicemeeter.Remote) bool {
+	changed := false
+	for _, kind := range []string{"Strip", "Bus"} {
+		devices, err := device.List(vm, kind, "")
+		if err != nil {
+			log.Printf("error listing devices: %v\n", err)
+			continue
+		}
+		deviceListMu.Lock()
+		if !slices.Equal(deviceLists[kind], devices) {
+			deviceLists[kind] = devices
+			changed = true
+		}
+		deviceListMu.Unlock()
+	}
+	return changed
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	cursorMap = cmap.NewOf[string, int]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		// the list may have changed, so point the cursor at the assigned device again
+		cursorMap.Remove(event.Context)
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		cursorMap.Remove(event.Context)
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		cursorMap.Remove(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+	refreshDeviceLists(vm)
+
+	action.RegisterHandler(streamdeck.DialRotate, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DialRotatePayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		devices := p.Settings.devices()
+		if len(devices) == 0 {
+			return nil
+		}
+		cursor := currentCursor(vm, event.Context, p.Settings, devices)
+		cursor = (cursor + p.Ticks) % len(devices)
+		if cursor < 0 {
+			cursor += len(devices)
+		}
+		cursorMap.Set(event.Context, cursor)
+
+		go renderCurrentState(client, vm, event.Context, p.Settings)
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.DialDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DialDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		devices := p.Settings.devices()
+		cursor := currentCursor(vm, event.Context, p.Settings, devices)
+		if cursor < 0 || cursor >= len(devices) {
+			err := fmt.Errorf("no device selected")
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		if err := device.Assign(vm, p.Settings.StripOrBusKind, p.Settings.StripOrBusIndex, devices[cursor]); err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		errreport.Clear(ctx, client)
+		return nil
+	})
+
+	// Tapping the touch strip discards the selection and shows the assigned
+	// device again.
+	action.RegisterHandler(streamdeck.TouchTap, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.TouchTapPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		cursorMap.Remove(event.Context)
+		go renderCurrentState(client, vm, event.Context, p.Settings)
+		return nil
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	go func() {
+		for w := range willAppearOrSettingsChangedChan {
+			go renderCurrentState(client, vm, w.actionContext, w.settings)
+		}
+	}()
+
+	vmEvent := vmevent.Subscribe()
+	go func() {
+		for e := range vmEvent {
+			switch e {
+			case "pdirty":
+				for item := range shownInstances.IterBuffered() {
+					go renderCurrentState(client, vm, item.Key, item.Val.Settings)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		for range time.Tick(deviceRefreshInterval) {
+			if shownInstances.Count() == 0 {
+				continue
+			}
+			if !refreshDeviceLists(vm) {
+				continue
+			}
+			cursorMap.Clear()
+			for item := range shownInstances.IterBuffered() {
+				go renderCurrentState(client, vm, item.Key, item.Val.Settings)
+			}
+		}
+	}()
+
+	go func() {
+		for range resync.Subscribe() {
+			refreshDeviceLists(vm)
+			cursorMap.Clear()
+			for item := range shownInstances.IterBuffered() {
+				go renderCurrentState(client, vm, item.Key, item.Val.Settings)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// currentCursor returns the position of the selection, which starts at the
+// assigned device.
+func currentCursor(vm *voicemeeter.Remote, actionContext string, settings instanceSettings, devices []device.Device) int {
+	if cursor, ok := cursorMap.Get(actionContext); ok && cursor < len(devices) {
+		return cursor
+	}
+	assigned, err := device.GetAssigned(vm, settings.StripOrBusKind, settings.StripOrBusIndex)
+	if err != nil {
+		return 0
+	}
+	cursor := slices.IndexFunc(devices, func(d device.Device) bool { return d.Name == assigned })
+	if cursor < 0 {
+		cursor = 0
+	}
+	return cursor
+}
+
+func renderCurrentState(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string, settings instanceSettings) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	assigned, err := device.GetAssigned(vm, settings.StripOrBusKind, settings.StripOrBusIndex)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error getting assigned device: %w", err))
+	}
+	devices := settings.devices()
+	renderCh <- &renderParams{
+		targetContext: actionContext,
+		settings:      settings,
+		assigned:      assigned,
+		devices:       devices,
+		cursor:        currentCursor(vm, actionContext, settings, devices),
+	}
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) error {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	// the error overlay stays until the action draws itself on its settings
+	if errreport.Showing(renderParam.targetContext) {
+		return nil
+	}
+
+	payload := struct {
+		Title  *string `json:"title,omitempty"`
+		Icon   *string `json:"icon,omitempty"`
+		Device *string `json:"device,omitempty"`
+		Info   *string `json:"info,omitempty"`
+	}{}
+
+	settings := renderParam.settings
+	title := fmt.Sprintf("%v %v", settings.StripOrBusKind, settings.StripOrBusIndex)
+	payload.Title = &title
+
+	deviceStr := "-"
+	info := "No device"
+	iconColor := color.Color(color.White)
+	if n := len(renderParam.devices); n > 0 && renderParam.cursor < n {
+		d := renderParam.devices[renderParam.cursor]
+		deviceStr = d.Name
+		if d.Name == renderParam.assigned {
+			info = fmt.Sprintf("%v %v/%v", strings.ToUpper(d.Type), renderParam.cursor+1, n)
+		} else {
+			// not assigned yet; press the dial to assign
+			info = fmt.Sprintf("%v %v/%v ▶ Press", strings.ToUpper(d.Type), renderParam.cursor+1, n)
+			iconColor = color.RGBA{0xe8, 0xb1, 0x5f, 0xff}
+		}
+	} else if renderParam.assigned != "" {
+		deviceStr = renderParam.assigned
+	}
+	payload.Device = &deviceStr
+	payload.Info = &info
+
+	fontParams := settings.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+	iconCodePoint := settings.IconCodePoint
+	if iconCodePoint == "" {
+		switch settings.StripOrBusKind {
+		case "Bus":
+			iconCodePoint = "e32d" // speaker
+		default:
+			iconCodePoint = "e029" // mic
+		}
+	}
+	svg, err := fontParams.RenderIconSVG(iconCodePoint, 48, 48, 0, 0, iconColor, color.RGBA{0, 0, 0, 180}, color.Transparent, 1)
+	if err != nil {
+		log.Printf("error creating image: %v\n", err)
+		return err
+	}
+	icon := streamdeck.ImageSvg(svg)
+	payload.Icon = &icon
+
+	if err := client.SetFeedback(ctx, payload); err != nil {
+		log.Printf("error setting feedback: %v\n", err)
+		return err
+	}
+	return nil
+}
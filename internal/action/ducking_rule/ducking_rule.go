@@ -0,0 +1,532 @@
+package ducking_rule
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/ducking"
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/globalsettings"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
+	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID = "jp.hrko.streamdeck.voicemeeter.ducking"
+
+	maxDepth = 60.0
+
+	rulesKey = "duckingRules" // entry of the global settings
+
+	stateOff = 0
+	stateOn  = 1
+)
+
+var (
+	shownInstances                  *cmap.MapOf[string, instanceProperty]
+	willAppearOrSettingsChangedChan = make(chan struct {
+		actionContext string
+		settings      instanceSettings
+	}, 32)
+	// Rules keep running while their key is on another page, so they are
+	// stored in the global settings and run from the start of the plugin.
+	duckerMap *cmap.MapOf[string, *ducking.Ducker] // key: context of action instance
+	titleMap  *cmap.MapOf[string, string]          // key: context of action instance, value: state and title last shown
+	renderCh  chan *renderParams
+	rulesMu   sync.Mutex
+	rules     = map[string]instanceSettings{} // key: context of action instance
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	Enabled        bool                               `json:"enabled,omitempty"`
+	TriggerKind    string                             `json:"triggerKind,omitempty"` // "Strip" | "Bus"
+	TriggerIndex   int                                `json:"triggerIndex,omitempty"`
+	Threshold      string                             `json:"threshold,omitempty"`  // dB
+	TargetKind     string                             `json:"targetKind,omitempty"` // "Strip" | "Bus"
+	TargetIndex    int                                `json:"targetIndex,omitempty"`
+	Depth          string                             `json:"depth,omitempty"`   // dB
+	Attack         string                             `json:"attack,omitempty"`  // ms
+	Hold           string                             `json:"hold,omitempty"`    // ms
+	Release        string                             `json:"release,omitempty"` // ms
+	IconFontParams graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePoint  string                             `json:"iconCodePoint,omitempty"`
+	BgColorOn      string                             `json:"bgColorOn,omitempty"`
+	BgColorOff     string                             `json:"bgColorOff,omitempty"`
+}
+
+type renderParams struct {
+	targetContext string
+	settings      instanceSettings
+	controller    string
+	depth         float64
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		Enabled:      false,
+		TriggerKind:  "Strip",
+		TriggerIndex: 0,
+		Threshold:    "-30",
+		TargetKind:   "Strip",
+		TargetIndex:  5,
+		Depth:        "12",
+		Attack:       "50",
+		Hold:         "500",
+		Release:      "500",
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePoint: "",
+		BgColorOn:     "#e8b15f",
+		BgColorOff:    "#004162",
+	}
+}
+
+func parseFloat(name, s string, fallback float64) float64 {
+	v, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		log.Printf("invalid %v: '%v'\n", name, s)
+		return fallback
+	}
+	return v
+}
+
+func parseMilliseconds(name, s string, fallback time.Duration) time.Duration {
+	ms, err := strconv.Atoi(s)
+	if err != nil || ms < 0 {
+		log.Printf("invalid %v: '%v'\n", name, s)
+		return fallback
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func (s *instanceSettings) rule() ducking.Rule {
+	depth := parseFloat("depth", s.Depth, 12)
+	if depth < 0 {
+		depth = -depth
+	}
+	return ducking.Rule{
+		Trigger:   levelstream.Source{Kind: s.TriggerKind, Index: s.TriggerIndex},
+		Threshold: parseFloat("threshold", s.Threshold, -30),
+		Target:    levelstream.Source{Kind: s.TargetKind, Index: s.TargetIndex},
+		Depth:     depth,
+		Attack:    parseMilliseconds("attack", s.Attack, 50*time.Millisecond),
+		Hold:      parseMilliseconds("hold", s.Hold, 500*time.Millisecond),
+		Release:   parseMilliseconds("release", s.Release, 500*time.Millisecond),
+	}
+}
+
+func (s *instanceSettings) fontParams() graphics.MaterialSymbolsFontParams {
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+	return fontParams
+}
+
+func (s *instanceSettings) iconCodePoint() string {
+	if s.IconCodePoint != "" {
+		return s.IconCodePoint
+	}
+	return "e04d" // volume_down
+}
+
+func (s *instanceSettings) setImages(client *streamdeck.Client, actionContext string) error {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	fontParams := s.fontParams()
+	iconColor := color.White
+	borderColor := color.Transparent
+	bgColorOn, _ := colors.ParseHEX(s.BgColorOn)
+	bgColorOff, _ := colors.ParseHEX(s.BgColorOff)
+
+	// the icon is placed at the top, leaving room for the depth title
+	iconSize := 36
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := 6
+	borderWidth := 0
+
+	svgOff, err := fontParams.RenderIconSVG(s.iconCodePoint(), iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOff, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+	svgOn, err := fontParams.RenderIconSVG(s.iconCodePoint(), iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOn, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgOff), streamdeck.HardwareAndSoftware, ptr(stateOff))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgOn), streamdeck.HardwareAndSoftware, ptr(stateOn))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// applySettings creates or updates the ducker of the instance and starts or
+// stops it.
+func applySettings(vm *voicemeeter.Remote, actionContext string, settings instanceSettings) error {
+	rule := settings.rule()
+	d, ok := duckerMap.Get(actionContext)
+	if !ok {
+		d = ducking.New(stripbus.Gains{VM: vm}, rule)
+		duckerMap.Set(actionContext, d)
+	} else if d.Rule() != rule {
+		if err := d.SetRule(rule); err != nil {
+			log.Printf("error setting ducking rule: %v\n", err)
+			return err
+		}
+	}
+
+	if !settings.Enabled {
+		d.Stop()
+		return nil
+	}
+	if err := d.Start(); err != nil {
+		log.Printf("error starting ducking rule: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// storeRule saves the settings of the instance in the global settings.
+func storeRule(client *streamdeck.Client, actionContext string, settings instanceSettings) error {
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if stored, ok := rules[actionContext]; ok && stored == settings {
+		return nil
+	}
+	rules[actionContext] = settings
+	if err := globalsettings.Set(context.Background(), client, rulesKey, rules); err != nil {
+		log.Printf("error setting global settings: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// removeRule stops the ducker of the instance and drops its rule from the
+// global settings.
+func removeRule(client *streamdeck.Client, actionContext string) error {
+	if d, ok := duckerMap.Get(actionContext); ok {
+		d.Stop()
+		duckerMap.Remove(actionContext)
+	}
+
+	rulesMu.Lock()
+	defer rulesMu.Unlock()
+
+	if _, ok := rules[actionContext]; !ok {
+		return nil
+	}
+	delete(rules, actionContext)
+	if err := globalsettings.Set(context.Background(), client, rulesKey, rules); err != nil {
+		log.Printf("error setting global settings: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	duckerMap = cmap.NewOf[string, *ducking.Ducker]()
+	titleMap = cmap.NewOf[string, string]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		titleMap.Remove(event.Context)
+		if p.Controller == "Keypad" {
+			p.Settings.setImages(client, event.Context)
+		}
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		titleMap.Remove(event.Context)
+		if p.Controller == "Keypad" {
+			p.Settings.setImages(client, event.Context)
+		}
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		titleMap.Remove(event.Context)
+		// Stream Deck does not tell a removed key from a key on another
+		// page. A rule that is off is dropped, and comes back from the
+		// settings of the key when it appears again; a rule that is on
+		// keeps running.
+		if d, ok := duckerMap.Get(event.Context); ok && !d.Running() {
+			removeRule(client, event.Context)
+		}
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	// updateSettings saves the settings changed on the deck and applies them.
+	updateSettings := func(ctx context.Context, actionContext string, settings instanceSettings) error {
+		if err := client.SetSettings(ctx, settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		shownInstances.Upsert(actionContext, instanceProperty{}, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+			valueInMap.Settings = settings
+			return valueInMap
+		})
+		if err := applySettings(vm, actionContext, settings); err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		return storeRule(client, actionContext, settings)
+	}
+
+	toggleHandler := func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		instProps, ok := shownInstances.Get(event.Context)
+		if !ok {
+			return nil
+		}
+		settings := instProps.Settings
+		settings.Enabled = !settings.Enabled
+		return updateSettings(ctx, event.Context, settings)
+	}
+	action.RegisterHandler(streamdeck.KeyDown, toggleHandler)
+	action.RegisterHandler(streamdeck.DialDown, toggleHandler)
+	action.RegisterHandler(streamdeck.TouchTap, toggleHandler)
+
+	// Rotating the dial changes the depth in 1 dB steps.
+	action.RegisterHandler(streamdeck.DialRotate, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DialRotatePayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		depth := p.Settings.rule().Depth + float64(p.Ticks)
+		depth = max(0, min(maxDepth, depth))
+		p.Settings.Depth = strconv.FormatFloat(depth, 'f', -1, 64)
+		return updateSettings(ctx, event.Context, p.Settings)
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	stored := map[string]instanceSettings{}
+	if _, err := globalsettings.Get(rulesKey, &stored); err != nil {
+		log.Printf("error reading ducking rules: %v\n", err)
+	}
+	for actionContext, settings := range stored {
+		rulesMu.Lock()
+		rules[actionContext] = settings
+		rulesMu.Unlock()
+		applySettings(vm, actionContext, settings)
+	}
+
+	go func() {
+		for w := range willAppearOrSettingsChangedChan {
+			applySettings(vm, w.actionContext, w.settings)
+			storeRule(client, w.actionContext, w.settings)
+		}
+	}()
+
+	// The depth changes continuously, so refresh at the rate of the level stream.
+	go func() {
+		for range time.Tick(levelstream.Interval) {
+			for item := range shownInstances.IterBuffered() {
+				d, ok := duckerMap.Get(item.Key)
+				if !ok {
+					continue
+				}
+				renderCh <- &renderParams{
+					targetContext: item.Key,
+					settings:      item.Val.Settings,
+					controller:    item.Val.Controller,
+					depth:         d.Depth(),
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) error {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	// the error overlay stays until the action draws itself on its settings
+	if errreport.Showing(renderParam.targetContext) {
+		return nil
+	}
+
+	settings := renderParam.settings
+	depthStr := fmt.Sprintf("-%.1f dB", renderParam.depth)
+
+	switch renderParam.controller {
+	case "Keypad":
+		title := ""
+		state := stateOff
+		if settings.Enabled {
+			title = depthStr
+			state = stateOn
+		}
+		shown := fmt.Sprintf("%v:%v", state, title)
+		if lastShown, ok := titleMap.Get(renderParam.targetContext); ok && lastShown == shown {
+			return nil
+		}
+		if err := client.SetState(ctx, state); err != nil {
+			log.Printf("error setting state: %v\n", err)
+			return err
+		}
+		if err := client.SetTitle(ctx, title, streamdeck.HardwareAndSoftware, nil); err != nil {
+			log.Printf("error setting title: %v\n", err)
+			return err
+		}
+		titleMap.Set(renderParam.targetContext, shown)
+
+	case "Encoder":
+		payload := struct {
+			Title      *string `json:"title,omitempty"`
+			Icon       *string `json:"icon,omitempty"`
+			State      *string `json:"state,omitempty"`
+			DepthValue *string `json:"depthValue,omitempty"`
+			DepthBar   *string `json:"depthBar,omitempty"`
+		}{}
+
+		title := fmt.Sprintf("%v %v → %v %v", settings.TriggerKind, settings.TriggerIndex, settings.TargetKind, settings.TargetIndex)
+		payload.Title = &title
+		stateStr := "OFF"
+		if settings.Enabled {
+			stateStr = "ON"
+		}
+		payload.State = &stateStr
+		payload.DepthValue = &depthStr
+
+		fontParams := settings.fontParams()
+		var iconColor color.Color = color.White
+		if settings.Enabled {
+			if c, err := colors.ParseHEX(settings.BgColorOn); err == nil {
+				iconColor = c
+			}
+		}
+		svg, err := fontParams.RenderIconSVG(settings.iconCodePoint(), 48, 48, 0, 0, iconColor, color.RGBA{0, 0, 0, 180}, color.Transparent, 1)
+		if err != nil {
+			log.Printf("error creating image: %v\n", err)
+			return err
+		}
+		icon := streamdeck.ImageSvg(svg)
+		payload.Icon = &icon
+
+		// the bar shrinks from the right as the target is ducked
+		ruleDepth := settings.rule().Depth
+		bar := graphics.NewGainFader()
+		bar.Width = 108
+		bar.Height = 12
+		bar.DbMin = -ruleDepth
+		bar.DbMax = 0
+		if ruleDepth == 0 {
+			bar.DbMin = -1
+		}
+		bar.Color.ForegroundNormal = color.RGBA{0xe8, 0xb1, 0x5f, 0xff}
+		img := bar.RenderHorizontal(-renderParam.depth)
+		imgBase64, err := streamdeck.Image(img)
+		if err != nil {
+			log.Printf("error creating image: %v\n", err)
+			return err
+		}
+		payload.DepthBar = &imgBase64
+
+		if err := client.SetFeedback(ctx, payload); err != nil {
+			log.Printf("error setting feedback: %v\n", err)
+			return err
+		}
+
+	default:
+		log.Printf("unknown controller: %v\n", renderParam.controller)
+		return fmt.Errorf("unknown controller: %v", renderParam.controller)
+	}
+
+	return nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -14,14 +14,22 @@ import (
 	sdcontext "github.com/hrko/streamdeck/context"
 	"github.com/onyx-and-iris/voicemeeter/v2"
 
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
 	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
 	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
 )
 
+const (
+	ActionUUID = "jp.hrko.streamdeck.voicemeeter.gain-controll"
+)
+
 var (
 	instanceMap   *cmap.MapOf[string, instanceProperty]
 	renderCh      chan *renderParams
 	levelMeterMap *cmap.MapOf[string, *graphics.LevelMeter]
+	meters        *levelstream.Meters // key: context of action instance
 )
 
 type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
@@ -29,6 +37,8 @@ type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
 type instanceSettings struct {
 	IconCodePoint   string                             `json:"iconCodePoint,omitempty"`
 	IconFontParams  graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconImage       string                             `json:"iconImage,omitempty"`      // PNG, JPEG or SVG file replacing the glyph
+	IconSvg         string                             `json:"iconSvg,omitempty"`        // inline SVG replacing the glyph
 	StripOrBusKind  string                             `json:"stripOrBusKind,omitempty"` // "Strip" | "Bus"
 	StripOrBusIndex int                                `json:"stripOrBusIndex,omitempty"`
 	GainDelta       string                             `json:"gainDelta,omitempty"`
@@ -41,6 +51,7 @@ type renderParams struct {
 	levels        *[]float64
 	gain          *float64
 	status        stripbus.IStripOrBusStatus
+	err           error // first error met while collecting the params
 }
 
 func defaultInstanceSettings() instanceSettings {
@@ -60,8 +71,11 @@ func defaultInstanceSettings() instanceSettings {
 }
 
 func SetupPreClientRun(client *streamdeck.Client) {
-	action := client.Action("jp.hrko.streamdeck.voicemeeter.gain-controll")
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
 	instanceMap = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	meters = levelstream.NewMeters()
 	renderCh = make(chan *renderParams, 32)
 
 	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
@@ -110,12 +124,13 @@ func SetupPreClientRun(client *streamdeck.Client) {
 
 	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
 		instanceMap.Remove(event.Context)
+		meters.Remove(event.Context)
 		return nil
 	})
 }
 
 func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
-	action := client.Action("jp.hrko.streamdeck.voicemeeter.gain-controll")
+	action := client.Action(ActionUUID)
 	levelMeterMap = cmap.NewOf[string, *graphics.LevelMeter]() // key: context of action instance
 
 	action.RegisterHandler(streamdeck.DialRotate, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
@@ -238,6 +253,12 @@ func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error
 					renderParam.SetGain(vm, stripOrBusKind, stripOrBusIndex)
 					renderParam.SetStatus(vm, stripOrBusKind, stripOrBusIndex)
 
+					// the instance may have disappeared since the tick started
+					if !instanceMap.Has(actionContext) {
+						meters.Remove(actionContext)
+						return
+					}
+
 					renderCh <- renderParam
 				}()
 			}
@@ -258,27 +279,26 @@ func (p *renderParams) SetLevels(vm *voicemeeter.Remote, stripOrBusKind string,
 	case "Strip":
 		stripCount := len(vm.Strip)
 		if stripOrBusIndex >= stripCount || stripOrBusIndex < 0 {
-			log.Printf("stripOrBusIndex %v is out of range\n", stripOrBusIndex)
+			p.setErr(fmt.Errorf("stripOrBusIndex %v is out of range", stripOrBusIndex))
 			return
 		}
-		levels := vm.Strip[stripOrBusIndex].Levels().PostFader()
-		levels = levels[:2]
-		p.levels = &levels
 
 	case "Bus":
 		busCount := len(vm.Bus)
 		if stripOrBusIndex >= busCount || stripOrBusIndex < 0 {
-			log.Printf("stripOrBusIndex %v is out of range\n", stripOrBusIndex)
+			p.setErr(fmt.Errorf("stripOrBusIndex %v is out of range", stripOrBusIndex))
 			return
 		}
-		levels := vm.Bus[stripOrBusIndex].Levels().All()
-		levels = levels[:2]
-		p.levels = &levels
 
 	default:
-		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		p.setErr(fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind))
 		return
 	}
+
+	levels := meters.Levels(p.targetContext, levelstream.Source{Kind: stripOrBusKind, Index: stripOrBusIndex})
+	if levels != nil {
+		p.levels = &levels
+	}
 }
 
 func (p *renderParams) SetTitle(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) {
@@ -286,7 +306,7 @@ func (p *renderParams) SetTitle(vm *voicemeeter.Remote, stripOrBusKind string, s
 	case "Strip":
 		stripCount := len(vm.Strip)
 		if stripOrBusIndex >= stripCount || stripOrBusIndex < 0 {
-			log.Printf("stripOrBusIndex %v is out of range\n", stripOrBusIndex)
+			p.setErr(fmt.Errorf("stripOrBusIndex %v is out of range", stripOrBusIndex))
 			return
 		}
 		title := vm.Strip[stripOrBusIndex].Label()
@@ -298,7 +318,7 @@ func (p *renderParams) SetTitle(vm *voicemeeter.Remote, stripOrBusKind string, s
 	case "Bus":
 		busCount := len(vm.Bus)
 		if stripOrBusIndex >= busCount || stripOrBusIndex < 0 {
-			log.Printf("stripOrBusIndex %v is out of range\n", stripOrBusIndex)
+			p.setErr(fmt.Errorf("stripOrBusIndex %v is out of range", stripOrBusIndex))
 			return
 		}
 		title := vm.Bus[stripOrBusIndex].Label()
@@ -308,7 +328,7 @@ func (p *renderParams) SetTitle(vm *voicemeeter.Remote, stripOrBusKind string, s
 		p.title = &title
 
 	default:
-		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		p.setErr(fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind))
 		return
 	}
 }
@@ -318,7 +338,7 @@ func (p *renderParams) SetGain(vm *voicemeeter.Remote, stripOrBusKind string, st
 	case "Strip":
 		stripCount := len(vm.Strip)
 		if stripOrBusIndex >= stripCount || stripOrBusIndex < 0 {
-			log.Printf("stripOrBusIndex %v is out of range\n", stripOrBusIndex)
+			p.setErr(fmt.Errorf("stripOrBusIndex %v is out of range", stripOrBusIndex))
 			return
 		}
 		gain := vm.Strip[stripOrBusIndex].Gain()
@@ -327,14 +347,14 @@ func (p *renderParams) SetGain(vm *voicemeeter.Remote, stripOrBusKind string, st
 	case "Bus":
 		busCount := len(vm.Bus)
 		if stripOrBusIndex >= busCount || stripOrBusIndex < 0 {
-			log.Printf("stripOrBusIndex %v is out of range\n", stripOrBusIndex)
+			p.setErr(fmt.Errorf("stripOrBusIndex %v is out of range", stripOrBusIndex))
 			return
 		}
 		gain := vm.Bus[stripOrBusIndex].Gain()
 		p.gain = &gain
 
 	default:
-		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		p.setErr(fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind))
 		return
 	}
 }
@@ -342,16 +362,32 @@ func (p *renderParams) SetGain(vm *voicemeeter.Remote, stripOrBusKind string, st
 func (p *renderParams) SetStatus(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) {
 	s, err := stripbus.GetStripOrBusStatus(vm, stripOrBusKind, stripOrBusIndex)
 	if err != nil {
-		log.Printf("error getting strip or bus status: %v\n", err)
+		p.setErr(err)
 		return
 	}
 	p.status = s
 }
 
+func (p *renderParams) setErr(err error) {
+	log.Printf("%v\n", err)
+	if p.err == nil {
+		p.err = err
+	}
+}
+
 func render(client *streamdeck.Client, renderParam *renderParams) error {
-	ctx := context.Background()
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
 	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
 
+	// the error overlay stays until the action draws itself on its settings
+	if errreport.Showing(renderParam.targetContext) {
+		return nil
+	}
+
+	if renderParam.err != nil {
+		errreport.ReportOnce(ctx, client, renderParam.err)
+	}
+
 	instProps, ok := instanceMap.Get(renderParam.targetContext)
 	if !ok {
 		return fmt.Errorf("instProps has no key '%v'", renderParam.targetContext)
@@ -380,7 +416,7 @@ func render(client *streamdeck.Client, renderParam *renderParams) error {
 		if renderParam.settings != nil {
 			fontParams := renderParam.settings.IconFontParams
 			if err := fontParams.Assert(); err != nil {
-				log.Printf("invalid iconFontParams: %v\n", err)
+				errreport.ReportOnce(ctx, client, fmt.Errorf("invalid iconFontParams: %w", err))
 				fontParams = graphics.MaterialSymbolsFontParams{}
 				fontParams.FillEmptyWithDefault()
 			}
@@ -393,9 +429,16 @@ func render(client *streamdeck.Client, renderParam *renderParams) error {
 					iconCodePoint = "f70e" // output_circle
 				}
 			}
-			svg, err := fontParams.RenderIconSVG(iconCodePoint, 48, 48, 0, 0, color.White, color.RGBA{0, 0, 0, 180}, color.Transparent, 1)
+			var svg string
+			var err error
+			customIcon := graphics.CustomIcon{File: renderParam.settings.IconImage, SVG: renderParam.settings.IconSvg}
+			if customIcon.IsSet() {
+				svg, err = customIcon.RenderIconSVG(48, 48, 0, 0, color.RGBA{0, 0, 0, 180}, color.Transparent, 1)
+			} else {
+				svg, err = fontParams.RenderIconSVG(iconCodePoint, 48, 48, 0, 0, color.White, color.RGBA{0, 0, 0, 180}, color.Transparent, 1)
+			}
 			if err != nil {
-				log.Printf("error creating image: %v\n", err)
+				errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
 				return err
 			}
 			imgString := streamdeck.ImageSvg(svg)
@@ -8,6 +8,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"image"
 	"image/color"
 	"log"
 	"strconv"
@@ -18,6 +19,9 @@ import (
 	sdcontext "github.com/hrko/streamdeck/context"
 	"github.com/onyx-and-iris/voicemeeter/v2"
 
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
 	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
 	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
 )
@@ -31,6 +35,7 @@ var (
 	renderCh       chan *renderParams
 	levelMeterMap  *cmap.MapOf[string, *graphics.LevelMeter]
 	levelMeter1Map *cmap.MapOf[string, *graphics.LevelMeter]
+	meters         *levelstream.Meters // key: context of action instance, or meter1ID of it
 )
 
 type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
@@ -38,11 +43,15 @@ type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
 type instanceSettings struct {
 	IconCodePoint    string                             `json:"iconCodePoint,omitempty"`
 	IconFontParams   graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconImage        string                             `json:"iconImage,omitempty"`      // PNG, JPEG or SVG file replacing the glyph
+	IconSvg          string                             `json:"iconSvg,omitempty"`        // inline SVG replacing the glyph
 	StripOrBusKind   string                             `json:"stripOrBusKind,omitempty"` // "Strip" | "Bus"
 	StripOrBusIndex  int                                `json:"stripOrBusIndex,omitempty"`
 	GainDelta        string                             `json:"gainDelta,omitempty"`
 	IconCodePoint1   string                             `json:"iconCodePoint1,omitempty"`
 	IconFontParams1  graphics.MaterialSymbolsFontParams `json:"iconFontParams1,omitempty"`
+	IconImage1       string                             `json:"iconImage1,omitempty"`
+	IconSvg1         string                             `json:"iconSvg1,omitempty"`
 	StripOrBusKind1  string                             `json:"stripOrBusKind1,omitempty"` // "Strip" | "Bus"
 	StripOrBusIndex1 int                                `json:"stripOrBusIndex1,omitempty"`
 	GainDelta1       string                             `json:"gainDelta1,omitempty"`
@@ -59,6 +68,7 @@ type renderParams struct {
 	levels1       *[]float64
 	gain1         *float64
 	status1       stripbus.IStripOrBusStatus
+	err           error // first error met while collecting the params
 }
 
 func defaultInstanceSettings() instanceSettings {
@@ -90,7 +100,10 @@ func defaultInstanceSettings() instanceSettings {
 
 func SetupPreClientRun(client *streamdeck.Client) {
 	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
 	instanceMap = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	meters = levelstream.NewMeters()
 	renderCh = make(chan *renderParams, 32)
 
 	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
@@ -139,6 +152,7 @@ func SetupPreClientRun(client *streamdeck.Client) {
 
 	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
 		instanceMap.Remove(event.Context)
+		removeMeters(event.Context)
 		return nil
 	})
 }
@@ -272,6 +286,12 @@ func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error
 					renderParam.SetGain1(vm, stripOrBusKind1, stripOrBusIndex1)
 					renderParam.SetStatus1(vm, stripOrBusKind1, stripOrBusIndex1)
 
+					// the instance may have disappeared since the tick started
+					if !instanceMap.Has(actionContext) {
+						removeMeters(actionContext)
+						return
+					}
+
 					renderCh <- renderParam
 				}()
 			}
@@ -288,24 +308,30 @@ func newRenderParams(actionContext string) *renderParams {
 }
 
 func (p *renderParams) SetLevels(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) {
-	l, err := getLevels(vm, stripOrBusKind, stripOrBusIndex)
+	l, err := getLevels(vm, p.targetContext, stripOrBusKind, stripOrBusIndex)
 	if err != nil {
-		log.Printf("error getting levels: %v\n", err)
+		p.setErr(err)
 		return
 	}
-	p.levels = &l
+	if l != nil {
+		p.levels = &l
+	}
 }
 
 func (p *renderParams) SetLevels1(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) {
-	l, err := getLevels(vm, stripOrBusKind, stripOrBusIndex)
+	l, err := getLevels(vm, meter1ID(p.targetContext), stripOrBusKind, stripOrBusIndex)
 	if err != nil {
-		log.Printf("error getting levels: %v\n", err)
+		p.setErr(err)
 		return
 	}
-	p.levels1 = &l
+	if l != nil {
+		p.levels1 = &l
+	}
 }
 
-func getLevels(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) ([]float64, error) {
+// getLevels returns the levels of the meter from the level stream, or nil
+// before its first tick.
+func getLevels(vm *voicemeeter.Remote, meterID string, stripOrBusKind string, stripOrBusIndex int) ([]float64, error) {
 	switch stripOrBusKind {
 	case "Strip":
 		stripCount := len(vm.Strip)
@@ -313,9 +339,6 @@ func getLevels(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex in
 			log.Printf("stripOrBusIndex %v is out of range\n", stripOrBusIndex)
 			return nil, fmt.Errorf("stripOrBusIndex %v is out of range", stripOrBusIndex)
 		}
-		levels := vm.Strip[stripOrBusIndex].Levels().PostFader()
-		levels = levels[:2]
-		return levels, nil
 
 	case "Bus":
 		busCount := len(vm.Bus)
@@ -323,20 +346,30 @@ func getLevels(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex in
 			log.Printf("stripOrBusIndex %v is out of range\n", stripOrBusIndex)
 			return nil, fmt.Errorf("stripOrBusIndex %v is out of range", stripOrBusIndex)
 		}
-		levels := vm.Bus[stripOrBusIndex].Levels().All()
-		levels = levels[:2]
-		return levels, nil
 
 	default:
 		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
 		return nil, fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind)
 	}
+
+	levels := meters.Levels(meterID, levelstream.Source{Kind: stripOrBusKind, Index: stripOrBusIndex})
+	return levels, nil
+}
+
+// meter1ID returns the id of the second meter of the action instance.
+func meter1ID(actionContext string) string {
+	return actionContext + "/1"
+}
+
+func removeMeters(actionContext string) {
+	meters.Remove(actionContext)
+	meters.Remove(meter1ID(actionContext))
 }
 
 func (p *renderParams) SetTitle(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) {
 	title, err := getTitle(vm, stripOrBusKind, stripOrBusIndex)
 	if err != nil {
-		log.Printf("error getting title: %v\n", err)
+		p.setErr(err)
 		return
 	}
 	p.title = &title
@@ -345,7 +378,7 @@ func (p *renderParams) SetTitle(vm *voicemeeter.Remote, stripOrBusKind string, s
 func (p *renderParams) SetTitle1(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) {
 	title, err := getTitle(vm, stripOrBusKind, stripOrBusIndex)
 	if err != nil {
-		log.Printf("error getting title: %v\n", err)
+		p.setErr(err)
 		return
 	}
 	p.title1 = &title
@@ -386,7 +419,7 @@ func getTitle(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int
 func (p *renderParams) SetGain(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) {
 	gain, err := getGain(vm, stripOrBusKind, stripOrBusIndex)
 	if err != nil {
-		log.Printf("error getting gain: %v\n", err)
+		p.setErr(err)
 		return
 	}
 	p.gain = &gain
@@ -395,7 +428,7 @@ func (p *renderParams) SetGain(vm *voicemeeter.Remote, stripOrBusKind string, st
 func (p *renderParams) SetGain1(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) {
 	gain, err := getGain(vm, stripOrBusKind, stripOrBusIndex)
 	if err != nil {
-		log.Printf("error getting gain: %v\n", err)
+		p.setErr(err)
 		return
 	}
 	p.gain1 = &gain
@@ -430,7 +463,7 @@ func getGain(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int)
 func (p *renderParams) SetStatus(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) {
 	s, err := stripbus.GetStripOrBusStatus(vm, stripOrBusKind, stripOrBusIndex)
 	if err != nil {
-		log.Printf("error getting strip or bus status: %v\n", err)
+		p.setErr(err)
 		return
 	}
 	p.status = s
@@ -439,16 +472,32 @@ func (p *renderParams) SetStatus(vm *voicemeeter.Remote, stripOrBusKind string,
 func (p *renderParams) SetStatus1(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) {
 	s, err := stripbus.GetStripOrBusStatus(vm, stripOrBusKind, stripOrBusIndex)
 	if err != nil {
-		log.Printf("error getting strip or bus status: %v\n", err)
+		p.setErr(err)
 		return
 	}
 	p.status1 = s
 }
 
+func (p *renderParams) setErr(err error) {
+	log.Printf("%v\n", err)
+	if p.err == nil {
+		p.err = err
+	}
+}
+
 func render(client *streamdeck.Client, renderParam *renderParams) error {
-	ctx := context.Background()
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
 	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
 
+	// the error overlay stays until the action draws itself on its settings
+	if errreport.Showing(renderParam.targetContext) {
+		return nil
+	}
+
+	if renderParam.err != nil {
+		errreport.ReportOnce(ctx, client, renderParam.err)
+	}
+
 	instProps, ok := instanceMap.Get(renderParam.targetContext)
 	if !ok {
 		return fmt.Errorf("instanceMap has no key '%v'", renderParam.targetContext)
@@ -491,7 +540,7 @@ func render(client *streamdeck.Client, renderParam *renderParams) error {
 		if renderParam.settings != nil {
 			fontParams := renderParam.settings.IconFontParams
 			if err := fontParams.Assert(); err != nil {
-				log.Printf("invalid iconFontParams: %v\n", err)
+				errreport.ReportOnce(ctx, client, fmt.Errorf("invalid iconFontParams: %w", err))
 				fontParams = graphics.MaterialSymbolsFontParams{}
 				fontParams.FillEmptyWithDefault()
 			}
@@ -504,9 +553,16 @@ func render(client *streamdeck.Client, renderParam *renderParams) error {
 					iconCodePoint = "f70e" // output_circle
 				}
 			}
-			img, err := fontParams.RenderIcon(iconCodePoint, 20, 20, 0, 0, color.White, color.RGBA{0, 0, 0, 128}, color.Transparent, 1)
+			var img image.Image
+			var err error
+			customIcon := graphics.CustomIcon{File: renderParam.settings.IconImage, SVG: renderParam.settings.IconSvg}
+			if customIcon.IsSet() {
+				img, err = customIcon.RenderIcon(20, 20, 0, 0, color.RGBA{0, 0, 0, 128}, color.Transparent, 1)
+			} else {
+				img, err = fontParams.RenderIcon(iconCodePoint, 20, 20, 0, 0, color.White, color.RGBA{0, 0, 0, 128}, color.Transparent, 1)
+			}
 			if err != nil {
-				log.Printf("error creating image: %v\n", err)
+				errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
 				return err
 			}
 			imgBase64, err := streamdeck.Image(img)
@@ -518,7 +574,7 @@ func render(client *streamdeck.Client, renderParam *renderParams) error {
 		if renderParam.settings != nil {
 			fontParams := renderParam.settings.IconFontParams1
 			if err := fontParams.Assert(); err != nil {
-				log.Printf("invalid iconFontParams: %v\n", err)
+				errreport.ReportOnce(ctx, client, fmt.Errorf("invalid iconFontParams: %w", err))
 				fontParams = graphics.MaterialSymbolsFontParams{}
 				fontParams.FillEmptyWithDefault()
 			}
@@ -531,9 +587,16 @@ func render(client *streamdeck.Client, renderParam *renderParams) error {
 					iconCodePoint = "f70e" // output_circle
 				}
 			}
-			img, err := fontParams.RenderIcon(iconCodePoint, 20, 20, 0, 0, color.White, color.RGBA{0, 0, 0, 128}, color.Transparent, 1)
+			var img image.Image
+			var err error
+			customIcon := graphics.CustomIcon{File: renderParam.settings.IconImage1, SVG: renderParam.settings.IconSvg1}
+			if customIcon.IsSet() {
+				img, err = customIcon.RenderIcon(20, 20, 0, 0, color.RGBA{0, 0, 0, 128}, color.Transparent, 1)
+			} else {
+				img, err = fontParams.RenderIcon(iconCodePoint, 20, 20, 0, 0, color.White, color.RGBA{0, 0, 0, 128}, color.Transparent, 1)
+			}
 			if err != nil {
-				log.Printf("error creating image: %v\n", err)
+				errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
 				return err
 			}
 			imgBase64, err := streamdeck.Image(img)
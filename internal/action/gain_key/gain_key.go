@@ -0,0 +1,449 @@
+package gain_key
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
+	"github.com/hrko/streamdeck-voicemeeter/internal/resync"
+	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID         = "jp.hrko.streamdeck.voicemeeter.gain-key"
+	OperationSet       = "set"
+	OperationIncrement = "increment"
+	OperationDecrement = "decrement"
+
+	repeatDelay    = 400 * time.Millisecond
+	repeatInterval = 100 * time.Millisecond
+)
+
+var (
+	instanceMap   *cmap.MapOf[string, instanceProperty]
+	renderCh      chan *renderParams
+	levelMeterMap *cmap.MapOf[string, *graphics.LevelMeter]
+	iconMap       *cmap.MapOf[string, image.Image]   // key: context of action instance
+	titleMap      *cmap.MapOf[string, string]        // key: context of action instance
+	repeatStopMap *cmap.MapOf[string, chan struct{}] // key: context of action instance
+	meters        *levelstream.Meters                // key: context of action instance
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	IconCodePoint   string                             `json:"iconCodePoint,omitempty"`
+	IconFontParams  graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconImage       string                             `json:"iconImage,omitempty"` // PNG, JPEG or SVG file replacing the glyph
+	IconSvg         string                             `json:"iconSvg,omitempty"`   // inline SVG replacing the glyph
+	BgColor         string                             `json:"bgColor,omitempty"`
+	StripOrBusKind  string                             `json:"stripOrBusKind,omitempty"` // "Strip" | "Bus"
+	StripOrBusIndex int                                `json:"stripOrBusIndex,omitempty"`
+	Operation       string                             `json:"operation,omitempty"` // "set" | "increment" | "decrement"
+	GainValue       string                             `json:"gainValue,omitempty"`
+	GainDelta       string                             `json:"gainDelta,omitempty"`
+}
+
+type renderParams struct {
+	targetContext string
+	levels        *[]float64
+	gain          *float64
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		IconCodePoint: "",
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "24",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		BgColor:         "#000000",
+		StripOrBusKind:  "Strip",
+		StripOrBusIndex: 0,
+		Operation:       OperationIncrement,
+		GainValue:       "0.0",
+		GainDelta:       "1.0",
+	}
+}
+
+func (s *instanceSettings) renderIcon() (image.Image, error) {
+	customIcon := graphics.CustomIcon{File: s.IconImage, SVG: s.IconSvg}
+	if customIcon.IsSet() {
+		return customIcon.RenderIcon(28, 28, 0, 0, color.RGBA{0, 0, 0, 180}, color.Transparent, 1)
+	}
+
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+	iconCodePoint := s.IconCodePoint
+	if iconCodePoint == "" {
+		switch s.Operation {
+		case OperationIncrement:
+			iconCodePoint = "e050" // volume_up
+		case OperationDecrement:
+			iconCodePoint = "e04d" // volume_down
+		default:
+			iconCodePoint = "e429" // tune
+		}
+	}
+	return fontParams.RenderIcon(iconCodePoint, 28, 28, 0, 0, color.White, color.RGBA{0, 0, 0, 180}, color.Transparent, 1)
+}
+
+// apply performs the configured operation once.
+func (s *instanceSettings) apply(vm *voicemeeter.Remote) error {
+	switch s.Operation {
+	case OperationSet:
+		gain, err := strconv.ParseFloat(s.GainValue, 64)
+		if err != nil {
+			log.Printf("error parsing gainValue: %v\n", err)
+			return err
+		}
+		return stripbus.SetGain(vm, s.StripOrBusKind, s.StripOrBusIndex, gain)
+
+	case OperationIncrement, OperationDecrement:
+		gainDelta, err := strconv.ParseFloat(s.GainDelta, 64)
+		if err != nil {
+			log.Printf("error parsing gainDelta: %v\n", err)
+			gainDelta = 1.0 // default
+		}
+		if s.Operation == OperationDecrement {
+			gainDelta = -gainDelta
+		}
+		_, err = stripbus.AdjustGain(vm, s.StripOrBusKind, s.StripOrBusIndex, gainDelta)
+		return err
+
+	default:
+		log.Printf("unknown operation: '%v'\n", s.Operation)
+		return fmt.Errorf("unknown operation: '%v'", s.Operation)
+	}
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	instanceMap = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	meters = levelstream.NewMeters()
+	iconMap = cmap.NewOf[string, image.Image]()
+	titleMap = cmap.NewOf[string, string]()
+	repeatStopMap = cmap.NewOf[string, chan struct{}]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if instanceMap.Has(event.Context) {
+			var dummy instanceProperty
+			instanceMap.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		icon, err := p.Settings.renderIcon()
+		if err != nil {
+			errreport.Report(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+			return err
+		}
+		iconMap.Set(event.Context, icon)
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		instanceMap.Set(event.Context, instanceProperty(p))
+		titleMap.Remove(event.Context)
+		icon, err := p.Settings.renderIcon()
+		if err != nil {
+			errreport.Report(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		} else {
+			iconMap.Set(event.Context, icon)
+		}
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		instanceMap.Remove(event.Context)
+		iconMap.Remove(event.Context)
+		titleMap.Remove(event.Context)
+		meters.Remove(event.Context)
+		stopRepeat(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+	levelMeterMap = cmap.NewOf[string, *graphics.LevelMeter]() // key: context of action instance
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if err := p.Settings.apply(vm); err != nil {
+			errreport.Report(ctx, client, fmt.Errorf("error applying gain: %w", err))
+			return err
+		}
+		renderGain(client, vm, event.Context, p.Settings)
+
+		if p.Settings.Operation == OperationSet {
+			return nil
+		}
+
+		// auto-repeat while the key is held
+		stopRepeat(event.Context)
+		stop := make(chan struct{})
+		repeatStopMap.Set(event.Context, stop)
+		go func() {
+			select {
+			case <-stop:
+				return
+			case <-time.After(repeatDelay):
+			}
+			ticker := time.NewTicker(repeatInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-stop:
+					return
+				case <-ticker.C:
+					if err := p.Settings.apply(vm); err != nil {
+						errreport.Report(ctx, client, fmt.Errorf("error applying gain: %w", err))
+						return
+					}
+					renderGain(client, vm, event.Context, p.Settings)
+				}
+			}
+		}()
+
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.KeyUp, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		stopRepeat(event.Context)
+		return nil
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	go func() {
+		for range resync.Subscribe() {
+			titleMap.Clear()
+		}
+	}()
+
+	go func() {
+		const refreshInterval = time.Second / 15
+		for range time.Tick(refreshInterval) {
+			for item := range instanceMap.IterBuffered() {
+				actionContext := item.Key
+				actionProps := item.Val
+				go func() {
+					renderParam := newRenderParams(actionContext)
+					renderParam.SetLevels(actionProps.Settings.StripOrBusKind, actionProps.Settings.StripOrBusIndex)
+					if err := renderParam.SetGain(vm, actionProps.Settings.StripOrBusKind, actionProps.Settings.StripOrBusIndex); err != nil {
+						reportGainError(client, actionContext, err)
+					}
+
+					// the instance may have disappeared since the tick started
+					if !instanceMap.Has(actionContext) {
+						meters.Remove(actionContext)
+						return
+					}
+					renderCh <- renderParam
+				}()
+			}
+		}
+	}()
+
+	return nil
+}
+
+func stopRepeat(actionContext string) {
+	if stop, ok := repeatStopMap.Pop(actionContext); ok {
+		close(stop)
+	}
+}
+
+func renderGain(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string, settings instanceSettings) {
+	renderParam := newRenderParams(actionContext)
+	if err := renderParam.SetGain(vm, settings.StripOrBusKind, settings.StripOrBusIndex); err != nil {
+		reportGainError(client, actionContext, err)
+	}
+	renderCh <- renderParam
+}
+
+// reportGainError shows the error once; the refresh finds it on every tick.
+func reportGainError(client *streamdeck.Client, actionContext string, err error) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+	errreport.ReportOnce(ctx, client, err)
+}
+
+func newRenderParams(actionContext string) *renderParams {
+	return &renderParams{
+		targetContext: actionContext,
+	}
+}
+
+// SetLevels reads the levels from the level stream. Until its first tick the
+// meter is left out.
+func (p *renderParams) SetLevels(stripOrBusKind string, stripOrBusIndex int) {
+	levels := meters.Levels(p.targetContext, levelstream.Source{Kind: stripOrBusKind, Index: stripOrBusIndex})
+	if levels == nil {
+		return
+	}
+	p.levels = &levels
+}
+
+// SetGain reads the gain. On an error the gain is left out.
+func (p *renderParams) SetGain(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) error {
+	gain, err := stripbus.GetGain(vm, stripOrBusKind, stripOrBusIndex)
+	if err != nil {
+		return fmt.Errorf("error getting gain: %w", err)
+	}
+	p.gain = &gain
+	return nil
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) error {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	// the error overlay stays until the action draws itself on its settings
+	if errreport.Showing(renderParam.targetContext) {
+		return nil
+	}
+
+	instProps, ok := instanceMap.Get(renderParam.targetContext)
+	if !ok {
+		return fmt.Errorf("instanceMap has no key '%v'", renderParam.targetContext)
+	}
+
+	levelMeter, ok := levelMeterMap.Get(renderParam.targetContext)
+	if !ok {
+		levelMeter = graphics.NewLevelMeter(2)
+		levelMeterMap.Set(renderParam.targetContext, levelMeter)
+	}
+
+	if renderParam.gain != nil {
+		title := fmt.Sprintf("%.1f dB", *renderParam.gain)
+		if lastTitle, ok := titleMap.Get(renderParam.targetContext); !ok || lastTitle != title {
+			if err := client.SetTitle(ctx, title, streamdeck.HardwareAndSoftware, nil); err != nil {
+				log.Printf("error setting title: %v\n", err)
+				return err
+			}
+			titleMap.Set(renderParam.targetContext, title)
+		}
+	}
+
+	if renderParam.levels == nil {
+		return nil
+	}
+
+	const (
+		imgSize     = 72
+		iconSize    = 28
+		barWidth    = 64
+		barX        = (imgSize - barWidth) / 2
+		iconY       = 20
+		meterY      = 52
+		meterHeight = 4
+		faderY      = 58
+		faderHeight = 10
+	)
+
+	var bgColor color.Color = color.Black
+	if c, err := colors.ParseHEX(instProps.Settings.BgColor); err == nil {
+		bgColor = c
+	}
+	img := image.NewRGBA(image.Rect(0, 0, imgSize, imgSize))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bgColor), image.Point{}, draw.Src)
+
+	if icon, ok := iconMap.Get(renderParam.targetContext); ok {
+		x := (imgSize - iconSize) / 2
+		draw.Draw(img, image.Rect(x, iconY, x+iconSize, iconY+iconSize), icon, image.Point{}, draw.Over)
+	}
+
+	levelMeter.Image.Width = barWidth
+	levelMeter.Image.Height = meterHeight
+	levelMeter.Image.Padding.Left = 0
+	levelMeter.Image.Padding.Right = 0
+	levelMeter.Image.Padding.Top = 0
+	levelMeter.Image.Padding.Bottom = 0
+	levelMeter.Cell.Length = 1
+	levelMeter.PeakHold = graphics.LevelMeterPeakHoldFillPeakShowCurrent
+	meterImg, err := levelMeter.RenderHorizontal(*renderParam.levels)
+	if err != nil {
+		log.Printf("error creating image: %v\n", err)
+		return err
+	}
+	draw.Draw(img, image.Rect(barX, meterY, barX+barWidth, meterY+meterHeight), meterImg, image.Point{}, draw.Over)
+
+	if renderParam.gain != nil {
+		gainFader := graphics.NewGainFader()
+		gainFader.Width = barWidth
+		gainFader.Height = faderHeight
+		faderImg := gainFader.RenderHorizontal(*renderParam.gain)
+		draw.Draw(img, image.Rect(barX, faderY, barX+barWidth, faderY+faderHeight), faderImg, image.Point{}, draw.Over)
+	}
+
+	imgBase64, err := streamdeck.Image(img)
+	if err != nil {
+		log.Printf("error creating image: %v\n", err)
+		return err
+	}
+	if err := client.SetImage(ctx, imgBase64, streamdeck.HardwareAndSoftware, nil); err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+
+	return nil
+}
@@ -3,9 +3,14 @@ package macro
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"image/color"
 	"log"
+	"maps"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/fufuok/cmap"
 	"github.com/go-playground/colors"
@@ -13,13 +18,30 @@ import (
 	sdcontext "github.com/hrko/streamdeck/context"
 	"github.com/onyx-and-iris/voicemeeter/v2"
 
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/globalsettings"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/macrobuttons"
+	"github.com/hrko/streamdeck-voicemeeter/internal/resync"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmevent"
 	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
 )
 
 const (
-	ActionUUID       = "jp.hrko.streamdeck.voicemeeter.macro"
-	ButtonTypeToggle = "toggle"
-	ButtonTypePush   = "push"
+	ActionUUID          = "jp.hrko.streamdeck.voicemeeter.macro"
+	ButtonTypeToggle    = "toggle"
+	ButtonTypePush      = "push"
+	ButtonTypeStateOnly = "stateOnly" // flips the displayed state without running the scripts
+	ButtonTypeTrigger   = "trigger"   // holds the trigger state while the key is pressed
+	ButtonTypeLatch     = "latch"     // stays on until another macro key is pressed
+
+	// event name of the datasource of the button select in the property inspector
+	datasourceButtons = "getMacroButtons"
+
+	// how often the Macro Buttons configuration is checked for changes
+	buttonStyleRefreshInterval = 5 * time.Second
+
+	groupsKey = "macroGroups" // entry of the global settings
 )
 
 var (
@@ -29,8 +51,22 @@ var (
 		settings      instanceSettings
 	}, 32)
 	renderCh chan *renderParams
+	latchMap *cmap.MapOf[string, int]         // key: context of action instance, value: logicalId
+	styleMap *cmap.MapOf[string, buttonStyle] // key: context of action instance
+	// keys in a group, including the ones on pages not shown; a key must be
+	// turned off when another key of its group is pressed wherever it is.
+	// The members are stored in the global settings, so that keys not shown
+	// since the plugin started are known too.
+	groupMap *cmap.MapOf[string, groupMember] // key: context of action instance
+	groupsMu sync.Mutex
 )
 
+// groupMember is what the keys of a group know about each other.
+type groupMember struct {
+	Group     string `json:"group"`
+	LogicalId string `json:"logicalId"`
+}
+
 type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
 
 type instanceSettings struct {
@@ -39,8 +75,17 @@ type instanceSettings struct {
 	IconFontParams   graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
 	IconCodePointOn  string                             `json:"iconCodePointOn,omitempty"`
 	IconCodePointOff string                             `json:"iconCodePointOff,omitempty"`
+	IconImageOn      string                             `json:"iconImageOn,omitempty"` // PNG, JPEG or SVG file replacing the glyph
+	IconImageOff     string                             `json:"iconImageOff,omitempty"`
+	IconSvgOn        string                             `json:"iconSvgOn,omitempty"` // inline SVG replacing the glyph
+	IconSvgOff       string                             `json:"iconSvgOff,omitempty"`
 	BgColorOn        string                             `json:"bgColorOn,omitempty"`
 	BgColorOff       string                             `json:"bgColorOff,omitempty"`
+	ShowButtonName   bool                               `json:"showButtonName,omitempty"`
+	UseButtonColor   bool                               `json:"useButtonColor,omitempty"`
+	ButtonConfigPath string                             `json:"buttonConfigPath,omitempty"` // empty: default path of Macro Buttons
+	Group            string                             `json:"group,omitempty"`            // keys in a group act as radio buttons
+	GroupKeepOne     bool                               `json:"groupKeepOne,omitempty"`     // a group never has all buttons off
 }
 
 type renderParams struct {
@@ -48,27 +93,75 @@ type renderParams struct {
 	state         bool
 }
 
+// buttonStyle is what a key takes from the Macro Buttons configuration.
+type buttonStyle struct {
+	title string
+	color string
+}
+
+type datasourceItem struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+type datasourcePayload struct {
+	Event string           `json:"event"`
+	Items []datasourceItem `json:"items,omitempty"`
+}
+
 func (s *instanceSettings) getSafeLogicalId(vm *voicemeeter.Remote) (int, error) {
 	logicalId, err := strconv.Atoi(s.LogicalId)
 	if err != nil {
 		return 0, err
 	}
 
-	if logicalId < 0 || logicalId > len(vm.Button) {
-		return 0, nil
+	if logicalId < 0 || logicalId >= len(vm.Button) {
+		return 0, fmt.Errorf("macro button id %v is out of range", logicalId)
 	}
 
 	return logicalId, nil
 }
 
+// buttonStyle reads the name and color of the button from the Macro Buttons
+// configuration, as far as the settings ask for them.
+func (s *instanceSettings) buttonStyle() (buttonStyle, error) {
+	if !s.ShowButtonName && !s.UseButtonColor {
+		return buttonStyle{}, nil
+	}
+	logicalId, err := strconv.Atoi(s.LogicalId)
+	if err != nil {
+		return buttonStyle{}, nil
+	}
+	button, err := macrobuttons.Get(s.ButtonConfigPath, logicalId)
+	if err != nil {
+		return buttonStyle{}, fmt.Errorf("error reading macro buttons config: %w", err)
+	}
+
+	var style buttonStyle
+	if s.ShowButtonName {
+		style.title = button.Label()
+	}
+	if s.UseButtonColor {
+		style.color = button.ColorHex()
+	}
+	return style, nil
+}
+
 func (s *instanceSettings) setImages(client *streamdeck.Client, actionContext string) error {
-	ctx := context.Background()
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
 	ctx = sdcontext.WithContext(ctx, actionContext)
 
 	iconColor := color.White
 	borderColor := color.Transparent
 	bgColorOn, _ := colors.ParseHEX(s.BgColorOn)
 	bgColorOff, _ := colors.ParseHEX(s.BgColorOff)
+	style, err := s.buttonStyle()
+	if err != nil {
+		errreport.ReportOnce(ctx, client, err)
+	}
+	if style.color != "" {
+		bgColorOn, _ = colors.ParseHEX(style.color)
+	}
 
 	iconSize := 36
 	imgSize := 72
@@ -76,14 +169,20 @@ func (s *instanceSettings) setImages(client *streamdeck.Client, actionContext st
 	offsetY := offsetX
 	borderWidth := 0
 
-	svgOn, err := s.IconFontParams.RenderIconSVG(s.IconCodePointOn, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOn, borderWidth)
+	renderIcon := func(codePoint string, customIcon graphics.CustomIcon, bgColor color.Color) (string, error) {
+		if customIcon.IsSet() {
+			return customIcon.RenderIconSVG(iconSize, imgSize, offsetX, offsetY, borderColor, bgColor, borderWidth)
+		}
+		return s.IconFontParams.RenderIconSVG(codePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColor, borderWidth)
+	}
+	svgOn, err := renderIcon(s.IconCodePointOn, graphics.CustomIcon{File: s.IconImageOn, SVG: s.IconSvgOn}, bgColorOn)
 	if err != nil {
-		log.Printf("error rendering icon: %v\n", err)
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
 		return err
 	}
-	svgOff, err := s.IconFontParams.RenderIconSVG(s.IconCodePointOff, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOff, borderWidth)
+	svgOff, err := renderIcon(s.IconCodePointOff, graphics.CustomIcon{File: s.IconImageOff, SVG: s.IconSvgOff}, bgColorOff)
 	if err != nil {
-		log.Printf("error rendering icon: %v\n", err)
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
 		return err
 	}
 
@@ -124,8 +223,13 @@ func defaultInstanceSettings() instanceSettings {
 
 func SetupPreClientRun(client *streamdeck.Client) {
 	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
 	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
 	renderCh = make(chan *renderParams, 32)
+	latchMap = cmap.NewOf[string, int]()
+	styleMap = cmap.NewOf[string, buttonStyle]()
+	groupMap = cmap.NewOf[string, groupMember]()
 
 	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
 		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
@@ -143,6 +247,7 @@ func SetupPreClientRun(client *streamdeck.Client) {
 				return valueInMap
 			})
 		}
+		setGroupMember(client, event.Context, p.Settings)
 
 		p.Settings.setImages(client, event.Context)
 
@@ -163,6 +268,8 @@ func SetupPreClientRun(client *streamdeck.Client) {
 			return err
 		}
 		shownInstances.Set(event.Context, instanceProperty(p))
+		setGroupMember(client, event.Context, p.Settings)
+		styleMap.Remove(event.Context)
 		p.Settings.setImages(client, event.Context)
 		if err := client.SetSettings(ctx, p.Settings); err != nil {
 			log.Printf("error setting settings: %v\n", err)
@@ -177,6 +284,7 @@ func SetupPreClientRun(client *streamdeck.Client) {
 
 	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
 		shownInstances.Remove(event.Context)
+		styleMap.Remove(event.Context)
 		return nil
 	})
 }
@@ -184,6 +292,8 @@ func SetupPreClientRun(client *streamdeck.Client) {
 func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
 	action := client.Action(ActionUUID)
 
+	loadGroups(client)
+
 	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
 		var p streamdeck.KeyDownPayload[instanceSettings]
 		p.Settings = defaultInstanceSettings()
@@ -193,27 +303,42 @@ func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error
 			return err
 		}
 
+		releaseLatches(vm, event.Context)
+
 		logicalId, err := p.Settings.getSafeLogicalId(vm)
 		if err != nil {
-			log.Printf("error parsing logicalId: %v\n", err)
+			errreport.Report(ctx, client, err)
 			return err
 		}
 		button := vm.Button[logicalId]
 
-		if p.Settings.ButtonType == ButtonTypeToggle {
-			currentState := button.State()
-			button.SetState(!currentState)
-			renderCh <- &renderParams{
-				targetContext: event.Context,
-				state:         !currentState,
-			}
-		} else if p.Settings.ButtonType == ButtonTypePush {
+		if p.Settings.Group != "" {
+			pressGroupKey(vm, event.Context, p.Settings, logicalId)
+			return nil
+		}
+
+		switch p.Settings.ButtonType {
+		case ButtonTypeToggle:
+			button.SetState(!button.State())
+		case ButtonTypePush:
 			button.SetState(true)
-			renderCh <- &renderParams{
-				targetContext: event.Context,
-				state:         true,
+		case ButtonTypeStateOnly:
+			button.SetStateOnly(!button.State())
+		case ButtonTypeTrigger:
+			if err := setTrigger(vm, logicalId, true); err != nil {
+				log.Printf("error setting trigger: %v\n", err)
+				return err
+			}
+		case ButtonTypeLatch:
+			if !button.State() {
+				button.SetState(true)
 			}
+			latchMap.Set(event.Context, logicalId)
+		default:
+			log.Printf("unknown buttonType: '%v'\n", p.Settings.ButtonType)
+			return fmt.Errorf("unknown buttonType: '%v'", p.Settings.ButtonType)
 		}
+		renderState(vm, event.Context, logicalId)
 
 		return nil
 	})
@@ -229,30 +354,57 @@ func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error
 
 		logicalId, err := p.Settings.getSafeLogicalId(vm)
 		if err != nil {
-			log.Printf("error parsing logicalId: %v\n", err)
+			errreport.Report(ctx, client, err)
 			return err
 		}
 		button := vm.Button[logicalId]
 
-		if p.Settings.ButtonType == ButtonTypePush {
+		if p.Settings.Group != "" {
+			return nil
+		}
+
+		switch p.Settings.ButtonType {
+		case ButtonTypePush:
 			button.SetState(false)
-			renderCh <- &renderParams{
-				targetContext: event.Context,
-				state:         false,
+		case ButtonTypeTrigger:
+			if err := setTrigger(vm, logicalId, false); err != nil {
+				log.Printf("error setting trigger: %v\n", err)
+				return err
 			}
+		default:
+			return nil
 		}
+		renderState(vm, event.Context, logicalId)
 
 		return nil
 	})
 
+	// The button select in the property inspector asks for the names of the
+	// macro buttons.
+	action.RegisterHandler(streamdeck.SendToPlugin, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p datasourcePayload
+		if err := json.Unmarshal(event.Payload, &p); err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		if p.Event != datasourceButtons {
+			return nil
+		}
+
+		instProps, ok := shownInstances.Get(event.Context)
+		if !ok {
+			return nil
+		}
+		return sendButtonItems(ctx, client, instProps.Settings)
+	})
+
 	go func() {
 		for renderParam := range renderCh {
 			render(client, renderParam)
 		}
 	}()
 
-	vmEvent := make(chan string)
-	vm.Register(vmEvent)
+	vmEvent := vmevent.Subscribe()
 	go func() {
 		for e := range vmEvent {
 			switch e {
@@ -263,7 +415,9 @@ func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error
 					go func() {
 						logicalId, err := actionProps.Settings.getSafeLogicalId(vm)
 						if err != nil {
-							log.Printf("error parsing logicalId: %v\n", err)
+							ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+							ctx = sdcontext.WithContext(ctx, actionContext)
+							errreport.ReportOnce(ctx, client, err)
 							return
 						}
 						button := vm.Button[logicalId]
@@ -278,6 +432,17 @@ func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error
 		}
 	}()
 
+	go func() {
+		for range resync.Subscribe() {
+			for item := range shownInstances.IterBuffered() {
+				willAppearOrSettingsChangedChan <- struct {
+					actionContext string
+					settings      instanceSettings
+				}{item.Key, item.Val.Settings}
+			}
+		}
+	}()
+
 	go func() {
 		for w := range willAppearOrSettingsChangedChan {
 			actionContext := w.actionContext
@@ -285,7 +450,9 @@ func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error
 			go func() {
 				logicalId, err := actionSettings.getSafeLogicalId(vm)
 				if err != nil {
-					log.Printf("error parsing logicalId: %v\n", err)
+					ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+					ctx = sdcontext.WithContext(ctx, actionContext)
+					errreport.ReportOnce(ctx, client, err)
 					return
 				}
 				button := vm.Button[logicalId]
@@ -295,12 +462,195 @@ func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error
 				}
 				renderCh <- renderParam
 			}()
+			go applyButtonStyle(client, actionContext, actionSettings)
+
+			// refresh the button list in case the configuration path was changed
+			ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+			ctx = sdcontext.WithContext(ctx, actionContext)
+			go sendButtonItems(ctx, client, actionSettings)
 		}
 	}()
 
+	go func() {
+		for range time.Tick(buttonStyleRefreshInterval) {
+			for item := range shownInstances.IterBuffered() {
+				applyButtonStyle(client, item.Key, item.Val.Settings)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// applyButtonStyle sets the title from the Macro Buttons configuration, and
+// renders the images again if the color of the button has changed.
+func applyButtonStyle(client *streamdeck.Client, actionContext string, settings instanceSettings) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	style, err := settings.buttonStyle()
+	if err != nil {
+		errreport.ReportOnce(ctx, client, err)
+	}
+	last, ok := styleMap.Get(actionContext)
+	if ok && last == style {
+		return
+	}
+	styleMap.Set(actionContext, style)
+
+	// leave the title alone unless it was set from the configuration before
+	if (ok && last.title != style.title) || (!ok && settings.ShowButtonName) {
+		if err := client.SetTitle(ctx, style.title, streamdeck.HardwareAndSoftware, nil); err != nil {
+			log.Printf("error setting title: %v\n", err)
+		}
+	}
+	if ok && last.color != style.color {
+		settings.setImages(client, actionContext)
+	}
+}
+
+func sendButtonItems(ctx context.Context, client *streamdeck.Client, settings instanceSettings) error {
+	buttons, err := macrobuttons.Load(settings.ButtonConfigPath)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error reading macro buttons config: %w", err))
+	}
+
+	items := []datasourceItem{}
+	for i := 0; i < macrobuttons.ButtonCount; i++ {
+		label := strconv.Itoa(i)
+		if b, ok := buttons[i]; ok && b.Name != "" {
+			label = fmt.Sprintf("%v: %v", i, strings.ReplaceAll(b.Label(), "\n", " "))
+		}
+		items = append(items, datasourceItem{
+			Label: label,
+			Value: strconv.Itoa(i),
+		})
+	}
+
+	payload := datasourcePayload{
+		Event: datasourceButtons,
+		Items: items,
+	}
+	if err := client.SendToPropertyInspector(ctx, payload); err != nil {
+		log.Printf("error sending to property inspector: %v\n", err)
+		return err
+	}
 	return nil
 }
 
+// renderState renders the state Voicemeeter reports for the button.
+func renderState(vm *voicemeeter.Remote, actionContext string, logicalId int) {
+	renderCh <- &renderParams{
+		targetContext: actionContext,
+		state:         vm.Button[logicalId].State(),
+	}
+}
+
+// setTrigger sets the trigger state of a macro button. The parameter is set
+// directly because button.SetTrigger uses the StateOnly mode.
+func setTrigger(vm *voicemeeter.Remote, logicalId int, on bool) error {
+	value := 0.0
+	if on {
+		value = 1
+	}
+	return vm.SetFloat(fmt.Sprintf("Command.Button[%d].Trigger", logicalId), value)
+}
+
+// pressGroupKey turns the button on and the other buttons of the group off.
+// Pressing a key that is already on turns it off, unless the group must
+// keep one on.
+func pressGroupKey(vm *voicemeeter.Remote, actionContext string, settings instanceSettings, logicalId int) {
+	button := vm.Button[logicalId]
+	if button.State() {
+		if !settings.GroupKeepOne {
+			button.SetState(false)
+		}
+		renderState(vm, actionContext, logicalId)
+		return
+	}
+
+	button.SetState(true)
+	renderState(vm, actionContext, logicalId)
+	for item := range groupMap.IterBuffered() {
+		member := instanceSettings{LogicalId: item.Val.LogicalId}
+		if item.Key == actionContext || item.Val.Group != settings.Group {
+			continue
+		}
+		memberId, err := member.getSafeLogicalId(vm)
+		if err != nil {
+			continue
+		}
+		if memberId != logicalId && vm.Button[memberId].State() {
+			vm.Button[memberId].SetState(false)
+		}
+		renderState(vm, item.Key, memberId)
+	}
+}
+
+// setGroupMember records the group of the key and saves the members in the
+// global settings. The key stays a member while it is not shown, until its
+// settings change. Stream Deck does not tell a removed key from a key on
+// another page, so a key removed while in a group stays a member.
+func setGroupMember(client *streamdeck.Client, actionContext string, settings instanceSettings) {
+	member := groupMember{Group: settings.Group, LogicalId: settings.LogicalId}
+
+	groupsMu.Lock()
+	defer groupsMu.Unlock()
+
+	stored, ok := groupMap.Get(actionContext)
+	switch {
+	case member.Group == "" && !ok:
+		return
+	case member.Group == "":
+		groupMap.Remove(actionContext)
+	case ok && stored == member:
+		return
+	default:
+		groupMap.Set(actionContext, member)
+	}
+	saveGroups(client)
+}
+
+// loadGroups adds the members stored in the global settings, and saves the
+// members of the keys shown before the global settings were received.
+func loadGroups(client *streamdeck.Client) {
+	stored := map[string]groupMember{}
+	if _, err := globalsettings.Get(groupsKey, &stored); err != nil {
+		log.Printf("error reading macro groups: %v\n", err)
+	}
+
+	groupsMu.Lock()
+	defer groupsMu.Unlock()
+
+	for actionContext, member := range stored {
+		// keys shown since the plugin started are already up to date
+		groupMap.SetIfAbsent(actionContext, member)
+	}
+	if !maps.Equal(groupMap.Items(), stored) {
+		saveGroups(client)
+	}
+}
+
+// saveGroups must be called with groupsMu held.
+func saveGroups(client *streamdeck.Client) {
+	if err := globalsettings.Set(context.Background(), client, groupsKey, groupMap.Items()); err != nil {
+		log.Printf("error setting global settings: %v\n", err)
+	}
+}
+
+// releaseLatches turns off the buttons latched by keys other than
+// actionContext.
+func releaseLatches(vm *voicemeeter.Remote, actionContext string) {
+	for item := range latchMap.IterBuffered() {
+		if item.Key == actionContext {
+			continue
+		}
+		latchMap.Remove(item.Key)
+		vm.Button[item.Val].SetState(false)
+		renderState(vm, item.Key, item.Val)
+	}
+}
+
 func render(client *streamdeck.Client, renderParam *renderParams) {
 	ctx := context.Background()
 	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
@@ -0,0 +1,377 @@
+package multi_state
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"strings"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/resync"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmevent"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmscript"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID = "jp.hrko.streamdeck.voicemeeter.multi-state"
+
+	defaultIconCodePoint = "e837" // radio_button_checked
+	defaultBgColor       = "#004162"
+	unknownIconCodePoint = "e887" // help
+	unknownBgColor       = "#3a3a3a"
+
+	// state shown when the mixer matches none of the states
+	stateUnknown = -1
+)
+
+var (
+	shownInstances                  *cmap.MapOf[string, instanceProperty]
+	willAppearOrSettingsChangedChan = make(chan struct {
+		actionContext string
+		settings      instanceSettings
+	}, 32)
+	imagesMap *cmap.MapOf[string, keyImages] // key: context of action instance
+	shownMap  *cmap.MapOf[string, int]       // key: context of action instance, value: state shown
+	renderCh  chan *renderParams
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	States         string                             `json:"states,omitempty"` // one state per line: "label | icon | color | script"
+	IconFontParams graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+}
+
+// keyState is a state as configured in the settings.
+type keyState struct {
+	Label         string
+	IconCodePoint string
+	BgColor       string
+	Script        string
+}
+
+type keyImages struct {
+	states  []string
+	unknown string
+}
+
+type renderParams struct {
+	targetContext string
+	state         int
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		States: "", // the property inspector shows an example
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+	}
+}
+
+// parseStates parses one state per line as "label | icon | color | script".
+// Empty lines are skipped; icon and color may be left empty.
+func parseStates(text string) ([]keyState, error) {
+	states := []keyState{}
+	for i, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		fields := strings.SplitN(line, "|", 4)
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("line %d: expected 'label | icon | color | script'", i+1)
+		}
+		s := keyState{
+			Label:         strings.TrimSpace(fields[0]),
+			IconCodePoint: strings.TrimSpace(fields[1]),
+			BgColor:       strings.TrimSpace(fields[2]),
+			Script:        strings.TrimSpace(fields[3]),
+		}
+		if s.IconCodePoint == "" {
+			s.IconCodePoint = defaultIconCodePoint
+		}
+		if s.BgColor == "" {
+			s.BgColor = defaultBgColor
+		}
+		states = append(states, s)
+	}
+	if len(states) == 0 {
+		return nil, fmt.Errorf("no states")
+	}
+	return states, nil
+}
+
+func (s *instanceSettings) renderImages() (keyImages, error) {
+	states, err := parseStates(s.States)
+	if err != nil {
+		return keyImages{}, err
+	}
+
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+
+	iconColor := color.White
+	borderColor := color.Transparent
+
+	iconSize := 36
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := offsetX
+	borderWidth := 0
+
+	renderOne := func(iconCodePoint, bgColorHex string) (string, error) {
+		bgColor, err := colors.ParseHEX(bgColorHex)
+		if err != nil {
+			log.Printf("invalid color: '%v'\n", bgColorHex)
+			bgColor, _ = colors.ParseHEX(defaultBgColor)
+		}
+		svg, err := fontParams.RenderIconSVG(iconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColor, borderWidth)
+		if err != nil {
+			return "", fmt.Errorf("error rendering icon: %w", err)
+		}
+		return streamdeck.ImageSvg(svg), nil
+	}
+
+	images := keyImages{}
+	for _, state := range states {
+		img, err := renderOne(state.IconCodePoint, state.BgColor)
+		if err != nil {
+			return keyImages{}, err
+		}
+		images.states = append(images.states, img)
+	}
+	images.unknown, err = renderOne(unknownIconCodePoint, unknownBgColor)
+	if err != nil {
+		return keyImages{}, err
+	}
+	return images, nil
+}
+
+func updateImages(client *streamdeck.Client, actionContext string, settings instanceSettings) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	images, err := settings.renderImages()
+	if err != nil {
+		errreport.ReportOnce(ctx, client, err)
+		return
+	}
+	imagesMap.Set(actionContext, images)
+	shownMap.Remove(actionContext)
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	imagesMap = cmap.NewOf[string, keyImages]()
+	shownMap = cmap.NewOf[string, int]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		updateImages(client, event.Context, p.Settings)
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		updateImages(client, event.Context, p.Settings)
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		imagesMap.Remove(event.Context)
+		shownMap.Remove(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		states, err := parseStates(p.Settings.States)
+		if err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		next := (currentState(vm, states) + 1) % len(states)
+		if err := vmscript.Run(vm, states[next].Script); err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		renderCh <- &renderParams{
+			targetContext: event.Context,
+			state:         next,
+		}
+		return nil
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	vmEvent := vmevent.Subscribe()
+	go func() {
+		for e := range vmEvent {
+			switch e {
+			case "pdirty":
+				for item := range shownInstances.IterBuffered() {
+					go renderCurrentState(client, vm, item.Key, item.Val.Settings)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		for w := range willAppearOrSettingsChangedChan {
+			go renderCurrentState(client, vm, w.actionContext, w.settings)
+		}
+	}()
+
+	go func() {
+		for range resync.Subscribe() {
+			for item := range shownInstances.IterBuffered() {
+				go renderCurrentState(client, vm, item.Key, item.Val.Settings)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// currentState returns the first state whose script matches the mixer, or
+// stateUnknown.
+func currentState(vm *voicemeeter.Remote, states []keyState) int {
+	for i, state := range states {
+		matches, err := vmscript.Matches(vm, state.Script)
+		if err != nil {
+			log.Printf("error matching state '%v': %v\n", state.Label, err)
+			continue
+		}
+		if matches {
+			return i
+		}
+	}
+	return stateUnknown
+}
+
+func renderCurrentState(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string, settings instanceSettings) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	states, err := parseStates(settings.States)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, err)
+		return
+	}
+	renderCh <- &renderParams{
+		targetContext: actionContext,
+		state:         currentState(vm, states),
+	}
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) error {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	if shown, ok := shownMap.Get(renderParam.targetContext); ok && shown == renderParam.state {
+		return nil
+	}
+	instProps, ok := shownInstances.Get(renderParam.targetContext)
+	if !ok {
+		return nil
+	}
+	images, ok := imagesMap.Get(renderParam.targetContext)
+	if !ok {
+		return nil
+	}
+	states, err := parseStates(instProps.Settings.States)
+	if err != nil || len(states) != len(images.states) || renderParam.state >= len(states) {
+		// the settings are being changed; the next render catches up
+		return nil
+	}
+
+	img := images.unknown
+	title := ""
+	if renderParam.state != stateUnknown {
+		img = images.states[renderParam.state]
+		title = states[renderParam.state].Label
+	}
+
+	if err := client.SetImage(ctx, img, streamdeck.HardwareAndSoftware, nil); err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	if err := client.SetTitle(ctx, title, streamdeck.HardwareAndSoftware, nil); err != nil {
+		log.Printf("error setting title: %v\n", err)
+		return err
+	}
+	shownMap.Set(renderParam.targetContext, renderParam.state)
+	return nil
+}
@@ -0,0 +1,486 @@
+package push_to_talk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/ducking"
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
+	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID = "jp.hrko.streamdeck.voicemeeter.push-to-talk"
+)
+
+var (
+	instanceMap   *cmap.MapOf[string, instanceProperty]
+	renderCh      chan *renderParams
+	levelMeterMap *cmap.MapOf[string, *graphics.LevelMeter]
+	iconMap       *cmap.MapOf[string, talkIcons] // key: context of action instance
+	talkMap       *cmap.MapOf[string, *talk]     // key: context of action instance
+	meters        *levelstream.Meters            // key: context of action instance
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	StripIndex           int                                `json:"stripIndex,omitempty"`
+	Tail                 string                             `json:"tail,omitempty"` // in milliseconds
+	DuckStrips           []int                              `json:"duckStrips,omitempty"`
+	DuckAmount           string                             `json:"duckAmount,omitempty"` // in dB
+	IconFontParams       graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePointTalking string                             `json:"iconCodePointTalking,omitempty"`
+	IconCodePointIdle    string                             `json:"iconCodePointIdle,omitempty"`
+	BgColorTalking       string                             `json:"bgColorTalking,omitempty"`
+	BgColorIdle          string                             `json:"bgColorIdle,omitempty"`
+}
+
+type talkIcons struct {
+	talking image.Image
+	idle    image.Image
+}
+
+type renderParams struct {
+	targetContext string
+	levels        *[]float64
+	talking       *bool
+}
+
+// talk is the push-to-talk state of an action instance.
+type talk struct {
+	mu        sync.Mutex
+	talking   bool
+	tailTimer *time.Timer
+	ducked    []int // indexes of the strips the talk holds ducked
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		StripIndex: 0,
+		Tail:       "300",
+		DuckStrips: []int{},
+		DuckAmount: "12",
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePointTalking: "e029", // mic
+		IconCodePointIdle:    "e02b", // mic_off
+		BgColorTalking:       "#a3302a",
+		BgColorIdle:          "#004162",
+	}
+}
+
+func (s *instanceSettings) tail() time.Duration {
+	ms, err := strconv.Atoi(s.Tail)
+	if err != nil || ms < 0 {
+		log.Printf("invalid tail: '%v'\n", s.Tail)
+		ms = 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func (s *instanceSettings) duckAmount() float64 {
+	amount, err := strconv.ParseFloat(s.DuckAmount, 64)
+	if err != nil {
+		log.Printf("error parsing duckAmount: %v\n", err)
+		return 0
+	}
+	return max(amount, 0)
+}
+
+func (s *instanceSettings) renderIcons() (talkIcons, error) {
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+	talking, err := fontParams.RenderIcon(s.IconCodePointTalking, 36, 36, 0, 0, color.White, color.Transparent, color.Transparent, 0)
+	if err != nil {
+		return talkIcons{}, err
+	}
+	idle, err := fontParams.RenderIcon(s.IconCodePointIdle, 36, 36, 0, 0, color.White, color.Transparent, color.Transparent, 0)
+	if err != nil {
+		return talkIcons{}, err
+	}
+	return talkIcons{talking: talking, idle: idle}, nil
+}
+
+// start opens the mic and ducks the other strips. Pressing again during the
+// tail keeps the current talk going.
+func (t *talk) start(vm *voicemeeter.Remote, settings instanceSettings) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tailTimer != nil {
+		t.tailTimer.Stop()
+		t.tailTimer = nil
+	}
+	if t.talking {
+		return nil
+	}
+
+	if err := stripbus.SetMute(vm, "Strip", settings.StripIndex, false); err != nil {
+		return err
+	}
+	t.talking = true
+
+	amount := settings.duckAmount()
+	if amount == 0 {
+		return nil
+	}
+	// other keys may duck the same strips; the holds stack instead of
+	// saving and restoring gains of each other
+	t.ducked = nil
+	for _, index := range settings.DuckStrips {
+		if index == settings.StripIndex {
+			continue
+		}
+		if err := ducking.Hold(stripbus.Gains{VM: vm}, levelstream.Source{Kind: "Strip", Index: index}, t, amount); err != nil {
+			log.Printf("error ducking strip: %v\n", err)
+			continue
+		}
+		t.ducked = append(t.ducked, index)
+	}
+	return nil
+}
+
+// stop closes the mic after the tail.
+func (t *talk) stop(vm *voicemeeter.Remote, settings instanceSettings) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.talking {
+		return
+	}
+	if t.tailTimer != nil {
+		t.tailTimer.Stop()
+	}
+	t.tailTimer = time.AfterFunc(settings.tail(), func() {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.tailTimer = nil
+		t.end(vm, settings)
+	})
+}
+
+// stopNow closes the mic without waiting for the tail.
+func (t *talk) stopNow(vm *voicemeeter.Remote, settings instanceSettings) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.tailTimer != nil {
+		t.tailTimer.Stop()
+		t.tailTimer = nil
+	}
+	t.end(vm, settings)
+}
+
+// end must be called with t.mu held.
+func (t *talk) end(vm *voicemeeter.Remote, settings instanceSettings) {
+	if !t.talking {
+		return
+	}
+	t.talking = false
+
+	if err := stripbus.SetMute(vm, "Strip", settings.StripIndex, true); err != nil {
+		log.Printf("error setting mute: %v\n", err)
+	}
+	for _, index := range t.ducked {
+		if err := ducking.Release(stripbus.Gains{VM: vm}, levelstream.Source{Kind: "Strip", Index: index}, t); err != nil {
+			log.Printf("error releasing ducked strip: %v\n", err)
+		}
+	}
+	t.ducked = nil
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	instanceMap = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	meters = levelstream.NewMeters()
+	iconMap = cmap.NewOf[string, talkIcons]()
+	talkMap = cmap.NewOf[string, *talk]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if instanceMap.Has(event.Context) {
+			var dummy instanceProperty
+			instanceMap.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		icons, err := p.Settings.renderIcons()
+		if err != nil {
+			errreport.Report(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+			return err
+		}
+		iconMap.Set(event.Context, icons)
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		instanceMap.Set(event.Context, instanceProperty(p))
+		talkMap.SetIfAbsent(event.Context, &talk{})
+		icons, err := p.Settings.renderIcons()
+		if err != nil {
+			errreport.Report(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		} else {
+			iconMap.Set(event.Context, icons)
+		}
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+	levelMeterMap = cmap.NewOf[string, *graphics.LevelMeter]() // key: context of action instance
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		t, _ := talkMap.Get(event.Context)
+		if t == nil {
+			t = &talk{}
+			talkMap.Set(event.Context, t)
+		}
+		if err := t.start(vm, p.Settings); err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		renderTalkState(vm, event.Context, p.Settings)
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.KeyUp, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyUpPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if t, ok := talkMap.Get(event.Context); ok {
+			t.stop(vm, p.Settings)
+		}
+		return nil
+	})
+
+	// Never leave the mic open when the key goes away while it is held.
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillDisappearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if t, ok := talkMap.Pop(event.Context); ok {
+			t.stopNow(vm, p.Settings)
+		}
+		instanceMap.Remove(event.Context)
+		iconMap.Remove(event.Context)
+		levelMeterMap.Remove(event.Context)
+		meters.Remove(event.Context)
+		return nil
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	go func() {
+		const refreshInterval = time.Second / 15
+		for range time.Tick(refreshInterval) {
+			for item := range instanceMap.IterBuffered() {
+				actionContext := item.Key
+				actionProps := item.Val
+				go func() {
+					renderParam := newRenderParams(actionContext)
+					renderParam.SetLevels(actionProps.Settings.StripIndex)
+					renderParam.SetTalking(vm, actionProps.Settings.StripIndex)
+
+					// the instance may have disappeared since the tick started
+					if !instanceMap.Has(actionContext) {
+						meters.Remove(actionContext)
+						return
+					}
+					renderCh <- renderParam
+				}()
+			}
+		}
+	}()
+
+	return nil
+}
+
+func renderTalkState(vm *voicemeeter.Remote, actionContext string, settings instanceSettings) {
+	renderParam := newRenderParams(actionContext)
+	renderParam.SetLevels(settings.StripIndex)
+	renderParam.SetTalking(vm, settings.StripIndex)
+	renderCh <- renderParam
+}
+
+func newRenderParams(actionContext string) *renderParams {
+	return &renderParams{
+		targetContext: actionContext,
+	}
+}
+
+// SetLevels reads the levels from the level stream. Until its first tick the
+// key is left as it is.
+func (p *renderParams) SetLevels(stripIndex int) {
+	levels := meters.Levels(p.targetContext, levelstream.Source{Kind: "Strip", Index: stripIndex})
+	if levels == nil {
+		return
+	}
+	p.levels = &levels
+}
+
+// SetTalking reads the talk state from the mute state of the mic strip, so
+// the key also follows mute changes made outside of the plugin.
+func (p *renderParams) SetTalking(vm *voicemeeter.Remote, stripIndex int) {
+	mute, err := stripbus.GetMute(vm, "Strip", stripIndex)
+	if err != nil {
+		log.Printf("error getting mute: %v\n", err)
+		return
+	}
+	talking := !mute
+	p.talking = &talking
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) error {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	// the error overlay stays until the action draws itself on its settings
+	if errreport.Showing(renderParam.targetContext) {
+		return nil
+	}
+
+	instProps, ok := instanceMap.Get(renderParam.targetContext)
+	if !ok {
+		return fmt.Errorf("instanceMap has no key '%v'", renderParam.targetContext)
+	}
+
+	if renderParam.levels == nil || renderParam.talking == nil {
+		return nil
+	}
+
+	levelMeter, ok := levelMeterMap.Get(renderParam.targetContext)
+	if !ok {
+		levelMeter = graphics.NewLevelMeter(2)
+		levelMeterMap.Set(renderParam.targetContext, levelMeter)
+	}
+
+	const (
+		imgSize     = 72
+		iconSize    = 36
+		iconY       = 12
+		meterWidth  = 64
+		meterX      = (imgSize - meterWidth) / 2
+		meterY      = 56
+		meterHeight = 8
+	)
+
+	bgColorHex := instProps.Settings.BgColorIdle
+	if *renderParam.talking {
+		bgColorHex = instProps.Settings.BgColorTalking
+	}
+	var bgColor color.Color = color.Black
+	if c, err := colors.ParseHEX(bgColorHex); err == nil {
+		bgColor = c
+	}
+	img := image.NewRGBA(image.Rect(0, 0, imgSize, imgSize))
+	draw.Draw(img, img.Bounds(), image.NewUniform(bgColor), image.Point{}, draw.Src)
+
+	if icons, ok := iconMap.Get(renderParam.targetContext); ok {
+		icon := icons.idle
+		if *renderParam.talking {
+			icon = icons.talking
+		}
+		x := (imgSize - iconSize) / 2
+		draw.Draw(img, image.Rect(x, iconY, x+iconSize, iconY+iconSize), icon, image.Point{}, draw.Over)
+	}
+
+	levelMeter.Image.Width = meterWidth
+	levelMeter.Image.Height = meterHeight
+	levelMeter.Image.Padding.Left = 0
+	levelMeter.Image.Padding.Right = 0
+	levelMeter.Image.Padding.Top = 0
+	levelMeter.Image.Padding.Bottom = 0
+	levelMeter.Cell.Length = 1
+	levelMeter.PeakHold = graphics.LevelMeterPeakHoldFillPeakShowCurrent
+	meterImg, err := levelMeter.RenderHorizontal(*renderParam.levels)
+	if err != nil {
+		log.Printf("error creating image: %v\n", err)
+		return err
+	}
+	draw.Draw(img, image.Rect(meterX, meterY, meterX+meterWidth, meterY+meterHeight), meterImg, image.Point{}, draw.Over)
+
+	imgBase64, err := streamdeck.Image(img)
+	if err != nil {
+		log.Printf("error creating image: %v\n", err)
+		return err
+	}
+	if err := client.SetImage(ctx, imgBase64, streamdeck.HardwareAndSoftware, nil); err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,511 @@
+package recorder_transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/recorder"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID    = "jp.hrko.streamdeck.voicemeeter.recorder"
+	DialModeScrub = "scrub"
+	DialModeGain  = "gain"
+
+	stateOff = 0
+	stateOn  = 1
+)
+
+var (
+	shownInstances *cmap.MapOf[string, instanceProperty]
+	keyStateMap    *cmap.MapOf[string, int]    // key: context of action instance
+	iconMap        *cmap.MapOf[string, string] // key: context of action instance
+	renderCh       chan *renderParams
+	clock          recorder.Clock
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	Operation      string                             `json:"operation,omitempty"` // used by keys: "play" | "stop" | "record" | "pause" | "rew" | "ff" | "loop"
+	DialMode       string                             `json:"dialMode,omitempty"`  // used by dials: "scrub" | "gain"
+	GainDelta      string                             `json:"gainDelta,omitempty"`
+	IconFontParams graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePoint  string                             `json:"iconCodePoint,omitempty"`
+	BgColorOn      string                             `json:"bgColorOn,omitempty"`
+	BgColorOff     string                             `json:"bgColorOff,omitempty"`
+}
+
+type renderParams struct {
+	targetContext string
+	settings      instanceSettings
+	controller    string
+	state         *recorder.State
+	elapsed       time.Duration
+	gain          *float64
+}
+
+type operationStyle struct {
+	iconCodePoint string
+	colorOn       string
+}
+
+// The colors follow the status indicator of the dial actions.
+var operationStyles = map[string]operationStyle{
+	recorder.OperationPlay:   {"e037", "#70c399"}, // play_arrow
+	recorder.OperationStop:   {"e047", ""},        // stop
+	recorder.OperationRecord: {"e061", "#f66051"}, // fiber_manual_record
+	recorder.OperationPause:  {"e034", "#e8b15f"}, // pause
+	recorder.OperationRew:    {"e020", ""},        // fast_rewind
+	recorder.OperationFf:     {"e01f", ""},        // fast_forward
+	recorder.OperationLoop:   {"e040", "#5f9ee8"}, // repeat
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		Operation: recorder.OperationPlay,
+		DialMode:  DialModeScrub,
+		GainDelta: "1.0",
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePoint: "",
+		BgColorOn:     "",
+		BgColorOff:    "#004162",
+	}
+}
+
+func (s *instanceSettings) style() operationStyle {
+	if style, ok := operationStyles[s.Operation]; ok {
+		return style
+	}
+	return operationStyles[recorder.OperationPlay]
+}
+
+func (s *instanceSettings) fontParams() graphics.MaterialSymbolsFontParams {
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+	return fontParams
+}
+
+// isActive reports whether the key should be shown in the on state.
+func (s *instanceSettings) isActive(state recorder.State) bool {
+	switch s.Operation {
+	case recorder.OperationPlay:
+		return state.Playing && !state.Recording && !state.Paused
+	case recorder.OperationRecord:
+		return state.Recording && !state.Paused
+	case recorder.OperationPause:
+		return state.Paused
+	case recorder.OperationLoop:
+		return state.Loop
+	default:
+		return false
+	}
+}
+
+func (s *instanceSettings) setImages(client *streamdeck.Client, actionContext string) error {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	fontParams := s.fontParams()
+	style := s.style()
+	iconCodePoint := s.IconCodePoint
+	if iconCodePoint == "" {
+		iconCodePoint = style.iconCodePoint
+	}
+	bgColorOnHex := s.BgColorOn
+	if bgColorOnHex == "" {
+		bgColorOnHex = style.colorOn
+	}
+	if bgColorOnHex == "" {
+		bgColorOnHex = s.BgColorOff
+	}
+
+	iconColor := color.White
+	borderColor := color.Transparent
+	bgColorOn, _ := colors.ParseHEX(bgColorOnHex)
+	bgColorOff, _ := colors.ParseHEX(s.BgColorOff)
+
+	iconSize := 36
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := offsetX
+	borderWidth := 0
+
+	svgOff, err := fontParams.RenderIconSVG(iconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOff, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+	svgOn, err := fontParams.RenderIconSVG(iconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOn, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgOff), streamdeck.HardwareAndSoftware, ptr(stateOff))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgOn), streamdeck.HardwareAndSoftware, ptr(stateOn))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	keyStateMap = cmap.NewOf[string, int]()
+	iconMap = cmap.NewOf[string, string]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		// force the next refresh to send the state and the icon again
+		keyStateMap.Remove(event.Context)
+		iconMap.Remove(event.Context)
+		if p.Controller == "Keypad" {
+			p.Settings.setImages(client, event.Context)
+		}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		keyStateMap.Remove(event.Context)
+		iconMap.Remove(event.Context)
+		if p.Controller == "Keypad" {
+			p.Settings.setImages(client, event.Context)
+		}
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		keyStateMap.Remove(event.Context)
+		iconMap.Remove(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if err := recorder.Do(vm, p.Settings.Operation); err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.DialRotate, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DialRotatePayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		switch p.Settings.DialMode {
+		case DialModeGain:
+			gainDelta, parseErr := strconv.ParseFloat(p.Settings.GainDelta, 64)
+			if parseErr != nil {
+				log.Printf("error parsing gainDelta: %v\n", parseErr)
+				gainDelta = 1.0 // default
+			}
+			_, err = recorder.AdjustGain(vm, gainDelta*float64(p.Ticks))
+
+		default:
+			// each tick skips once
+			operation := recorder.OperationFf
+			ticks := p.Ticks
+			if ticks < 0 {
+				operation = recorder.OperationRew
+				ticks = -ticks
+			}
+			for i := 0; i < ticks && err == nil; i++ {
+				err = recorder.Do(vm, operation)
+			}
+		}
+		if err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.DialDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		state, err := recorder.GetState(vm)
+		if err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+
+		operation := recorder.OperationStop
+		if state.Stopped() {
+			operation = recorder.OperationPlay
+		}
+		if err := recorder.Do(vm, operation); err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.TouchTap, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		state, err := recorder.GetState(vm)
+		if err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+
+		operation := recorder.OperationPause
+		if state.Paused {
+			operation = recorder.OperationPlay
+		}
+		if err := recorder.Do(vm, operation); err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		return nil
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	// The recorder has no change notification of its own and the time
+	// counter has to advance anyway, so poll it like the dial level meters.
+	go func() {
+		const refreshInterval = time.Second / 15
+		for range time.Tick(refreshInterval) {
+			if shownInstances.Count() == 0 {
+				continue
+			}
+
+			var statePtr *recorder.State
+			var elapsed time.Duration
+			var gainPtr *float64
+			if state, err := recorder.GetState(vm); err == nil {
+				elapsed = clock.Update(state, time.Now())
+				statePtr = &state
+				if gain, err := recorder.GetGain(vm); err == nil {
+					gainPtr = &gain
+				}
+			}
+
+			for item := range shownInstances.IterBuffered() {
+				renderCh <- &renderParams{
+					targetContext: item.Key,
+					settings:      item.Val.Settings,
+					controller:    item.Val.Controller,
+					state:         statePtr,
+					elapsed:       elapsed,
+					gain:          gainPtr,
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) error {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	// the error overlay stays until the action draws itself on its settings
+	if errreport.Showing(renderParam.targetContext) {
+		return nil
+	}
+
+	switch renderParam.controller {
+	case "Keypad":
+		if renderParam.state == nil {
+			return nil
+		}
+		state := stateOff
+		if renderParam.settings.isActive(*renderParam.state) {
+			state = stateOn
+		}
+		if lastState, ok := keyStateMap.Get(renderParam.targetContext); ok && lastState == state {
+			return nil
+		}
+		if err := client.SetState(ctx, state); err != nil {
+			log.Printf("error setting state: %v\n", err)
+			return err
+		}
+		keyStateMap.Set(renderParam.targetContext, state)
+
+	case "Encoder":
+		payload := struct {
+			Title      *string `json:"title,omitempty"`
+			Icon       *string `json:"icon,omitempty"`
+			State      *string `json:"state,omitempty"`
+			Time       *string `json:"time,omitempty"`
+			Loop       *string `json:"loop,omitempty"`
+			GainValue  *string `json:"gainValue,omitempty"`
+			GainSlider *string `json:"gainSlider,omitempty"`
+		}{}
+
+		title := "Recorder"
+		payload.Title = &title
+
+		if renderParam.state == nil {
+			stateStr := "N/A"
+			timeStr := ""
+			payload.State = &stateStr
+			payload.Time = &timeStr
+		} else {
+			state := *renderParam.state
+			stateStr := state.String()
+			timeStr := recorder.FormatDuration(renderParam.elapsed)
+			loopStr := ""
+			if state.Loop {
+				loopStr = "LOOP"
+			}
+			payload.State = &stateStr
+			payload.Time = &timeStr
+			payload.Loop = &loopStr
+
+			if lastIcon, ok := iconMap.Get(renderParam.targetContext); !ok || lastIcon != stateStr {
+				icon, err := renderStateIcon(renderParam.settings, state)
+				if err != nil {
+					return err
+				}
+				payload.Icon = &icon
+				iconMap.Set(renderParam.targetContext, stateStr)
+			}
+		}
+
+		if renderParam.gain != nil {
+			str := fmt.Sprintf("%.1f dB", *renderParam.gain)
+			payload.GainValue = &str
+
+			gainFader := graphics.NewGainFader()
+			gainFader.Width = 108
+			gainFader.Height = 12
+			img := gainFader.RenderHorizontal(*renderParam.gain)
+			imgBase64, err := streamdeck.Image(img)
+			if err != nil {
+				log.Printf("error creating image: %v\n", err)
+				return err
+			}
+			payload.GainSlider = &imgBase64
+		}
+
+		if err := client.SetFeedback(ctx, payload); err != nil {
+			log.Printf("error setting feedback: %v\n", err)
+			return err
+		}
+
+	default:
+		log.Printf("unknown controller: %v\n", renderParam.controller)
+		return fmt.Errorf("unknown controller: %v", renderParam.controller)
+	}
+
+	return nil
+}
+
+// renderStateIcon renders the touch strip icon of the transport state,
+// colored like the corresponding key.
+func renderStateIcon(settings instanceSettings, state recorder.State) (string, error) {
+	var style operationStyle
+	switch {
+	case state.Paused:
+		style = operationStyles[recorder.OperationPause]
+	case state.Recording:
+		style = operationStyles[recorder.OperationRecord]
+	case state.Playing:
+		style = operationStyles[recorder.OperationPlay]
+	default:
+		style = operationStyles[recorder.OperationStop]
+	}
+
+	var iconColor color.Color = color.White
+	if style.colorOn != "" {
+		if c, err := colors.ParseHEX(style.colorOn); err == nil {
+			iconColor = c
+		}
+	}
+
+	fontParams := settings.fontParams()
+	svg, err := fontParams.RenderIconSVG(style.iconCodePoint, 48, 48, 0, 0, iconColor, color.RGBA{0, 0, 0, 180}, color.Transparent, 1)
+	if err != nil {
+		log.Printf("error creating image: %v\n", err)
+		return "", err
+	}
+	return streamdeck.ImageSvg(svg), nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,395 @@
+package restart
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/resync"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID         = "jp.hrko.streamdeck.voicemeeter.restart"
+	ConfirmNone        = "none"
+	ConfirmDoublePress = "doublePress"
+	ConfirmHold        = "hold"
+
+	// The Remote API does not report when the audio engine is up again,
+	// so the spinner is shown for a fixed time.
+	restartDuration  = 3 * time.Second
+	spinnerFrameRate = 15
+)
+
+const (
+	keyStateIdle = iota
+	keyStateArmed
+	keyStateRestarting
+)
+
+var (
+	shownInstances *cmap.MapOf[string, instanceProperty]
+	imagesMap      *cmap.MapOf[string, keyImages] // key: context of action instance
+	armMap         *cmap.MapOf[string, chan struct{}]
+	renderCh       chan *renderParams
+
+	restartMu  sync.Mutex
+	restarting bool
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	Confirm        string                             `json:"confirm,omitempty"`      // "none" | "doublePress" | "hold"
+	ConfirmDelay   string                             `json:"confirmDelay,omitempty"` // in milliseconds
+	IconFontParams graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePoint  string                             `json:"iconCodePoint,omitempty"`
+	BgColor        string                             `json:"bgColor,omitempty"`
+	BgColorArmed   string                             `json:"bgColorArmed,omitempty"`
+}
+
+type keyImages struct {
+	idle  string
+	armed string
+}
+
+type renderParams struct {
+	targetContext string
+	keyState      int
+	spinnerAngle  float64
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		Confirm:      ConfirmDoublePress,
+		ConfirmDelay: "1000",
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePoint: "f053", // restart_alt
+		BgColor:       "#004162",
+		BgColorArmed:  "#b36b00",
+	}
+}
+
+func (s *instanceSettings) confirmDelay() time.Duration {
+	ms, err := strconv.Atoi(s.ConfirmDelay)
+	if err != nil || ms <= 0 {
+		log.Printf("invalid confirmDelay: '%v'\n", s.ConfirmDelay)
+		ms = 1000
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func (s *instanceSettings) renderImages() (keyImages, error) {
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+
+	iconColor := color.White
+	borderColor := color.Transparent
+	bgColor, _ := colors.ParseHEX(s.BgColor)
+	bgColorArmed, _ := colors.ParseHEX(s.BgColorArmed)
+
+	iconSize := 36
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := offsetX
+	borderWidth := 0
+
+	svgIdle, err := fontParams.RenderIconSVG(s.IconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColor, borderWidth)
+	if err != nil {
+		return keyImages{}, err
+	}
+	svgArmed, err := fontParams.RenderIconSVG(s.IconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorArmed, borderWidth)
+	if err != nil {
+		return keyImages{}, err
+	}
+
+	return keyImages{
+		idle:  streamdeck.ImageSvg(svgIdle),
+		armed: streamdeck.ImageSvg(svgArmed),
+	}, nil
+}
+
+func updateImages(client *streamdeck.Client, actionContext string, settings instanceSettings) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	images, err := settings.renderImages()
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return
+	}
+	imagesMap.Set(actionContext, images)
+	renderCh <- &renderParams{
+		targetContext: actionContext,
+		keyState:      keyStateIdle,
+	}
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	imagesMap = cmap.NewOf[string, keyImages]()
+	armMap = cmap.NewOf[string, chan struct{}]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		updateImages(client, event.Context, p.Settings)
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		updateImages(client, event.Context, p.Settings)
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		imagesMap.Remove(event.Context)
+		disarm(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		switch p.Settings.Confirm {
+		case ConfirmNone:
+			go restartEngine(client, vm, event.Context)
+
+		case ConfirmHold:
+			stop := arm(event.Context)
+			go func() {
+				select {
+				case <-stop:
+				case <-time.After(p.Settings.confirmDelay()):
+					if disarm(event.Context) {
+						restartEngine(client, vm, event.Context)
+					}
+				}
+			}()
+
+		default: // ConfirmDoublePress
+			if disarm(event.Context) {
+				go restartEngine(client, vm, event.Context)
+				return nil
+			}
+			stop := arm(event.Context)
+			go func() {
+				select {
+				case <-stop:
+				case <-time.After(p.Settings.confirmDelay()):
+					if disarm(event.Context) {
+						renderCh <- &renderParams{
+							targetContext: event.Context,
+							keyState:      keyStateIdle,
+						}
+					}
+				}
+			}()
+		}
+
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.KeyUp, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyUpPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if p.Settings.Confirm == ConfirmHold && disarm(event.Context) {
+			renderCh <- &renderParams{
+				targetContext: event.Context,
+				keyState:      keyStateIdle,
+			}
+		}
+
+		return nil
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	return nil
+}
+
+// arm marks the instance as waiting for confirmation and returns a channel
+// that is closed when the instance is disarmed.
+func arm(actionContext string) chan struct{} {
+	disarm(actionContext)
+	stop := make(chan struct{})
+	armMap.Set(actionContext, stop)
+	renderCh <- &renderParams{
+		targetContext: actionContext,
+		keyState:      keyStateArmed,
+	}
+	return stop
+}
+
+// disarm reports whether the instance was armed.
+func disarm(actionContext string) bool {
+	stop, ok := armMap.Pop(actionContext)
+	if ok {
+		close(stop)
+	}
+	return ok
+}
+
+func restartEngine(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string) {
+	restartMu.Lock()
+	if restarting {
+		restartMu.Unlock()
+		log.Println("restart is already in progress")
+		return
+	}
+	restarting = true
+	restartMu.Unlock()
+	defer func() {
+		restartMu.Lock()
+		restarting = false
+		restartMu.Unlock()
+	}()
+
+	log.Println("Restarting voicemeeter audio engine")
+	vm.Command.Restart()
+
+	ticker := time.NewTicker(time.Second / spinnerFrameRate)
+	defer ticker.Stop()
+	timeout := time.After(restartDuration)
+	angle := 0.0
+loop:
+	for {
+		select {
+		case <-ticker.C:
+			angle = math.Mod(angle+math.Pi/8, 2*math.Pi)
+			renderCh <- &renderParams{
+				targetContext: actionContext,
+				keyState:      keyStateRestarting,
+				spinnerAngle:  angle,
+			}
+		case <-timeout:
+			break loop
+		}
+	}
+
+	vm.Sync()
+	resync.Broadcast()
+
+	renderCh <- &renderParams{
+		targetContext: actionContext,
+		keyState:      keyStateIdle,
+	}
+	ctx := sdcontext.WithContext(context.Background(), actionContext)
+	if err := client.ShowOk(ctx); err != nil {
+		log.Printf("error showing ok: %v\n", err)
+	}
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) error {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	var img string
+	switch renderParam.keyState {
+	case keyStateRestarting:
+		spinner := graphics.NewSpinner()
+		if instProps, ok := shownInstances.Get(renderParam.targetContext); ok {
+			if c, err := colors.ParseHEX(instProps.Settings.BgColor); err == nil {
+				spinner.Color.Background = c
+			}
+		}
+		imgBase64, err := streamdeck.Image(spinner.Render(renderParam.spinnerAngle))
+		if err != nil {
+			log.Printf("error creating image: %v\n", err)
+			return err
+		}
+		img = imgBase64
+
+	default:
+		images, ok := imagesMap.Get(renderParam.targetContext)
+		if !ok {
+			return nil
+		}
+		if renderParam.keyState == keyStateArmed {
+			img = images.armed
+		} else {
+			img = images.idle
+		}
+	}
+
+	if err := client.SetImage(ctx, img, streamdeck.HardwareAndSoftware, nil); err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	return nil
+}
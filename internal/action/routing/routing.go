@@ -0,0 +1,336 @@
+package routing
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/resync"
+	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmevent"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID  = "jp.hrko.streamdeck.voicemeeter.routing"
+	ModeToggle  = "toggle"
+	ModeCycle   = "cycle"
+	defaultBus  = "A1"
+	presetsHint = "A1\nA1, B1\nB1"
+)
+
+var (
+	shownInstances                  *cmap.MapOf[string, instanceProperty]
+	willAppearOrSettingsChangedChan = make(chan struct {
+		actionContext string
+		settings      instanceSettings
+	}, 32)
+	imageMap *cmap.MapOf[string, string] // key: context of action instance
+	renderCh chan *renderParams
+
+	colorPhysBus = color.RGBA{0x70, 0xc3, 0x99, 0xff}
+	colorVirtBus = color.RGBA{0x5f, 0x9e, 0xe8, 0xff}
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	StripIndex int    `json:"stripIndex,omitempty"`
+	Mode       string `json:"mode,omitempty"`    // "toggle" | "cycle"
+	Bus        string `json:"bus,omitempty"`     // used in toggle mode, e.g. "A1"
+	Presets    string `json:"presets,omitempty"` // used in cycle mode, one preset per line
+	BgColor    string `json:"bgColor,omitempty"`
+}
+
+type renderParams struct {
+	targetContext string
+	settings      instanceSettings
+	routing       []string
+	buses         []string
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		StripIndex: 0,
+		Mode:       ModeToggle,
+		Bus:        defaultBus,
+		Presets:    presetsHint,
+		BgColor:    "#000000",
+	}
+}
+
+// presets returns the configured presets. Buses not available in the running
+// Voicemeeter kind are an error.
+func (s *instanceSettings) presets(buses []string) ([][]string, error) {
+	return stripbus.ParseRoutingPresets(s.Presets, buses)
+}
+
+// nextPreset returns the preset following the one matching the current
+// routing. If no preset matches, the first preset is returned.
+func nextPreset(presets [][]string, routing []string) []string {
+	if len(presets) == 0 {
+		return nil
+	}
+	for i, preset := range presets {
+		if sameBuses(preset, routing) {
+			return presets[(i+1)%len(presets)]
+		}
+	}
+	return presets[0]
+}
+
+func sameBuses(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for _, bus := range a {
+		if !slices.Contains(b, bus) {
+			return false
+		}
+	}
+	return true
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	imageMap = cmap.NewOf[string, string]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+		// the key may show the error overlay, which the image must replace
+		imageMap.Remove(event.Context)
+
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		imageMap.Remove(event.Context)
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		imageMap.Remove(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		switch p.Settings.Mode {
+		case ModeCycle:
+			routing, err := stripbus.GetStripRouting(vm, p.Settings.StripIndex)
+			if err != nil {
+				errreport.Report(ctx, client, fmt.Errorf("error getting routing: %w", err))
+				return err
+			}
+			presets, err := p.Settings.presets(stripbus.OutputBuses(vm))
+			if err != nil {
+				errreport.Report(ctx, client, fmt.Errorf("invalid presets: %w", err))
+				return err
+			}
+			next := nextPreset(presets, routing)
+			if err := stripbus.SetStripRouting(vm, p.Settings.StripIndex, next); err != nil {
+				errreport.Report(ctx, client, fmt.Errorf("error setting routing: %w", err))
+				return err
+			}
+
+		default:
+			if _, err := stripbus.ToggleStripOutput(vm, p.Settings.StripIndex, p.Settings.Bus); err != nil {
+				errreport.Report(ctx, client, fmt.Errorf("error toggling output: %w", err))
+				return err
+			}
+		}
+
+		go renderCurrentState(client, vm, event.Context, p.Settings)
+		return nil
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	vmEvent := vmevent.Subscribe()
+	go func() {
+		for e := range vmEvent {
+			switch e {
+			case "pdirty":
+				renderAll(client, vm)
+			}
+		}
+	}()
+
+	go func() {
+		for w := range willAppearOrSettingsChangedChan {
+			go renderCurrentState(client, vm, w.actionContext, w.settings)
+		}
+	}()
+
+	go func() {
+		for range resync.Subscribe() {
+			imageMap.Clear()
+			renderAll(client, vm)
+		}
+	}()
+
+	return nil
+}
+
+func renderAll(client *streamdeck.Client, vm *voicemeeter.Remote) {
+	for item := range shownInstances.IterBuffered() {
+		go renderCurrentState(client, vm, item.Key, item.Val.Settings)
+	}
+}
+
+func renderCurrentState(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string, settings instanceSettings) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	routing, err := stripbus.GetStripRouting(vm, settings.StripIndex)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error getting routing: %w", err))
+		return
+	}
+	renderCh <- &renderParams{
+		targetContext: actionContext,
+		settings:      settings,
+		routing:       routing,
+		buses:         stripbus.OutputBuses(vm),
+	}
+}
+
+func busColor(bus string) color.Color {
+	if strings.HasPrefix(bus, "B") {
+		return colorVirtBus
+	}
+	return colorPhysBus
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) error {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	settings := renderParam.settings
+	indicator := graphics.NewRoutingIndicator()
+	if c, err := colors.ParseHEX(settings.BgColor); err == nil {
+		indicator.Background = c
+	}
+
+	var flags [][]bool
+	switch settings.Mode {
+	case ModeCycle:
+		// one row for the physical buses and one for the virtual buses
+		for _, prefix := range []string{"A", "B"} {
+			row := graphics.RoutingIndicatorRow{}
+			rowFlags := []bool{}
+			for _, bus := range renderParam.buses {
+				if !strings.HasPrefix(bus, prefix) {
+					continue
+				}
+				row.Labels = append(row.Labels, bus)
+				row.ColorsTrue = append(row.ColorsTrue, busColor(bus))
+				rowFlags = append(rowFlags, slices.Contains(renderParam.routing, bus))
+			}
+			indicator.Rows = append(indicator.Rows, row)
+			flags = append(flags, rowFlags)
+		}
+
+	default:
+		if !slices.Contains(renderParam.buses, settings.Bus) {
+			return fmt.Errorf("unknown bus: '%v'", settings.Bus)
+		}
+		indicator.Rows = []graphics.RoutingIndicatorRow{
+			{
+				Labels:     []string{settings.Bus},
+				ColorsTrue: []color.Color{busColor(settings.Bus)},
+			},
+		}
+		indicator.ChipHeight = 32
+		indicator.MarginX = 12
+		indicator.CornerRadius = 6
+		indicator.FontSize = 18
+		flags = [][]bool{{slices.Contains(renderParam.routing, settings.Bus)}}
+	}
+
+	img, err := indicator.Render(flags)
+	if err != nil {
+		log.Printf("error rendering routing: %v\n", err)
+		return err
+	}
+	imgBase64, err := streamdeck.Image(img)
+	if err != nil {
+		log.Printf("error creating image: %v\n", err)
+		return err
+	}
+	if lastImg, ok := imageMap.Get(renderParam.targetContext); ok && lastImg == imgBase64 {
+		return nil
+	}
+	if err := client.SetImage(ctx, imgBase64, streamdeck.HardwareAndSoftware, nil); err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	imageMap.Set(renderParam.targetContext, imgBase64)
+
+	return nil
+}
@@ -0,0 +1,217 @@
+package scene_recall
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/scene"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID = "jp.hrko.streamdeck.voicemeeter.scene"
+
+	// sent by the capture button in the property inspector
+	piEventCapture = "captureScene"
+)
+
+var (
+	shownInstances *cmap.MapOf[string, instanceProperty]
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	SceneName      string                             `json:"sceneName,omitempty"`
+	StripIndexes   []int                              `json:"stripIndexes,omitempty"`
+	BusIndexes     []int                              `json:"busIndexes,omitempty"`
+	Fade           string                             `json:"fade,omitempty"` // in milliseconds
+	IconFontParams graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePoint  string                             `json:"iconCodePoint,omitempty"`
+	BgColor        string                             `json:"bgColor,omitempty"`
+}
+
+type piPayload struct {
+	Event string `json:"event"`
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		SceneName:    "",
+		StripIndexes: []int{},
+		BusIndexes:   []int{},
+		Fade:         "0",
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePoint: "e871", // dashboard
+		BgColor:       "#004162",
+	}
+}
+
+func (s *instanceSettings) fade() time.Duration {
+	ms, err := strconv.Atoi(s.Fade)
+	if err != nil || ms < 0 {
+		log.Printf("invalid fade: '%v'\n", s.Fade)
+		ms = 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
+
+func (s *instanceSettings) setImage(client *streamdeck.Client, actionContext string) error {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+
+	iconColor := color.White
+	borderColor := color.Transparent
+	bgColor, _ := colors.ParseHEX(s.BgColor)
+
+	iconSize := 36
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := offsetX
+	borderWidth := 0
+
+	svg, err := fontParams.RenderIconSVG(s.IconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColor, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+	if err := client.SetImage(ctx, streamdeck.ImageSvg(svg), streamdeck.HardwareAndSoftware, nil); err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		p.Settings.setImage(client, event.Context)
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		p.Settings.setImage(client, event.Context)
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		s, err := scene.Get(p.Settings.SceneName)
+		if err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		if err := s.Apply(vm, p.Settings.fade()); err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		errreport.Clear(ctx, client)
+		return client.ShowOk(ctx)
+	})
+
+	action.RegisterHandler(streamdeck.SendToPlugin, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p piPayload
+		if err := json.Unmarshal(event.Payload, &p); err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		if p.Event != piEventCapture {
+			return nil
+		}
+
+		instProps, ok := shownInstances.Get(event.Context)
+		if !ok {
+			return nil
+		}
+		settings := instProps.Settings
+
+		s, err := scene.Capture(vm, settings.SceneName, settings.StripIndexes, settings.BusIndexes)
+		if err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		if err := scene.Put(s); err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		log.Printf("scene '%v' captured\n", s.Name)
+		errreport.Clear(ctx, client)
+		return client.ShowOk(ctx)
+	})
+
+	return nil
+}
@@ -0,0 +1,309 @@
+package sequence_key
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"image/color"
+	"log"
+	"sync"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/sequence"
+	"github.com/hrko/streamdeck-voicemeeter/internal/sequencer"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID          = "jp.hrko.streamdeck.voicemeeter.sequence"
+	PressAgainCancel    = "cancel"
+	PressAgainReverse   = "reverse"
+	defaultIconForward  = "e037" // play_arrow
+	defaultIconReversed = "e042" // replay
+)
+
+var (
+	shownInstances *cmap.MapOf[string, instanceProperty]
+	imagesMap      *cmap.MapOf[string, string]          // key: context of action instance
+	runMap         *cmap.MapOf[string, *run]            // key: context of action instance
+	undoMap        *cmap.MapOf[string, []sequence.Step] // key: context of action instance
+	renderCh       chan *renderParams
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	Steps          string                             `json:"steps,omitempty"`
+	PressAgain     string                             `json:"pressAgain,omitempty"` // "cancel" | "reverse"
+	IconFontParams graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePoint  string                             `json:"iconCodePoint,omitempty"`
+	BgColor        string                             `json:"bgColor,omitempty"`
+}
+
+type renderParams struct {
+	targetContext string
+	running       bool
+	progress      float64
+}
+
+// run is a sequence running on an instance.
+type run struct {
+	cancel  context.CancelFunc
+	done    chan struct{}
+	reverse bool
+
+	mu   sync.Mutex
+	undo []sequence.Step
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		Steps:      "",
+		PressAgain: PressAgainCancel,
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePoint: "",
+		BgColor:       "#004162",
+	}
+}
+
+func (s *instanceSettings) renderImage(reversible bool) (string, error) {
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+	iconCodePoint := s.IconCodePoint
+	if iconCodePoint == "" {
+		iconCodePoint = defaultIconForward
+		if reversible {
+			iconCodePoint = defaultIconReversed
+		}
+	}
+
+	iconColor := color.White
+	borderColor := color.Transparent
+	bgColor, _ := colors.ParseHEX(s.BgColor)
+
+	iconSize := 36
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := offsetX
+	borderWidth := 0
+
+	svg, err := fontParams.RenderIconSVG(iconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColor, borderWidth)
+	if err != nil {
+		return "", err
+	}
+	return streamdeck.ImageSvg(svg), nil
+}
+
+func updateImage(actionContext string, settings instanceSettings) {
+	img, err := settings.renderImage(undoMap.Has(actionContext))
+	if err != nil {
+		log.Printf("error rendering icon: %v\n", err)
+		return
+	}
+	imagesMap.Set(actionContext, img)
+	if !runMap.Has(actionContext) {
+		renderCh <- &renderParams{targetContext: actionContext}
+	}
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	imagesMap = cmap.NewOf[string, string]()
+	runMap = cmap.NewOf[string, *run]()
+	undoMap = cmap.NewOf[string, []sequence.Step]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		// the steps to undo may not match the new sequence
+		undoMap.Remove(event.Context)
+		updateImage(event.Context, p.Settings)
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		updateImage(event.Context, p.Settings)
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		// a running sequence keeps running on another page
+		shownInstances.Remove(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		reversible := p.Settings.PressAgain == PressAgainReverse
+
+		if r, ok := runMap.Get(event.Context); ok {
+			r.cancel()
+			<-r.done
+			undoMap.Remove(event.Context)
+			if reversible && !r.reverse {
+				r.mu.Lock()
+				undo := r.undo
+				r.mu.Unlock()
+				start(client, vm, event.Context, p.Settings, undo, true)
+			}
+			return nil
+		}
+
+		if reversible {
+			if undo, ok := undoMap.Pop(event.Context); ok {
+				start(client, vm, event.Context, p.Settings, undo, true)
+				return nil
+			}
+		}
+
+		steps, err := sequence.Parse(p.Settings.Steps)
+		if err == nil {
+			err = sequencer.Validate(vm, steps)
+		}
+		if err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		start(client, vm, event.Context, p.Settings, steps, false)
+		return nil
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	return nil
+}
+
+// start runs the steps on the instance in the background.
+func start(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string, settings instanceSettings, steps []sequence.Step, reverse bool) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &run{cancel: cancel, done: make(chan struct{}), reverse: reverse}
+	runMap.Set(actionContext, r)
+
+	progress := func(fraction float64) {
+		if reverse {
+			fraction = 1 - fraction
+		}
+		renderCh <- &renderParams{targetContext: actionContext, running: true, progress: fraction}
+	}
+	progress(0)
+
+	go func() {
+		defer close(r.done)
+		defer cancel()
+
+		undo, err := sequencer.Run(ctx, vm, steps, progress)
+		r.mu.Lock()
+		r.undo = undo
+		r.mu.Unlock()
+
+		if err == nil && !reverse && settings.PressAgain == PressAgainReverse {
+			undoMap.Set(actionContext, undo)
+		}
+		runMap.Remove(actionContext)
+		updateImage(actionContext, settings)
+
+		sdctx := sdcontext.WithAction(context.Background(), ActionUUID)
+		sdctx = sdcontext.WithContext(sdctx, actionContext)
+		switch {
+		case err == nil:
+			errreport.Clear(sdctx, client)
+			client.ShowOk(sdctx)
+		case !errors.Is(err, context.Canceled):
+			errreport.Report(sdctx, client, err)
+		}
+	}()
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) error {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	var img string
+	if renderParam.running {
+		spinner := graphics.NewSpinner()
+		if instProps, ok := shownInstances.Get(renderParam.targetContext); ok {
+			if c, err := colors.ParseHEX(instProps.Settings.BgColor); err == nil {
+				spinner.Color.Background = c
+			}
+		}
+		imgBase64, err := streamdeck.Image(spinner.RenderProgress(renderParam.progress))
+		if err != nil {
+			log.Printf("error creating image: %v\n", err)
+			return err
+		}
+		img = imgBase64
+	} else {
+		var ok bool
+		img, ok = imagesMap.Get(renderParam.targetContext)
+		if !ok {
+			return nil
+		}
+	}
+
+	if err := client.SetImage(ctx, img, streamdeck.HardwareAndSoftware, nil); err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	return nil
+}
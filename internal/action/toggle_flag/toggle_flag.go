@@ -0,0 +1,370 @@
+package toggle_flag
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/resync"
+	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmevent"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID = "jp.hrko.streamdeck.voicemeeter.toggle-flag"
+
+	// event name of the datasource of the flag select in the property inspector
+	datasourceFlags = "getFlags"
+
+	stateOff = 0
+	stateOn  = 1
+)
+
+var (
+	shownInstances                  *cmap.MapOf[string, instanceProperty]
+	willAppearOrSettingsChangedChan = make(chan struct {
+		actionContext string
+		settings      instanceSettings
+	}, 32)
+	renderCh chan *renderParams
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	StripOrBusKind   string                             `json:"stripOrBusKind,omitempty"` // "Strip" | "Bus"
+	StripOrBusIndex  int                                `json:"stripOrBusIndex,omitempty"`
+	Flag             string                             `json:"flag,omitempty"` // "mute" | "solo" | "mono" | "eq" | "mc" | "karaoke"
+	IconFontParams   graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePointOn  string                             `json:"iconCodePointOn,omitempty"`
+	IconCodePointOff string                             `json:"iconCodePointOff,omitempty"`
+	BgColorOn        string                             `json:"bgColorOn,omitempty"`
+	BgColorOff       string                             `json:"bgColorOff,omitempty"`
+}
+
+type renderParams struct {
+	targetContext string
+	on            bool
+}
+
+type datasourceItem struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+type datasourcePayload struct {
+	Event string           `json:"event"`
+	Items []datasourceItem `json:"items,omitempty"`
+}
+
+type flagStyle struct {
+	label         string
+	iconCodePoint string
+	bgColorOn     string
+}
+
+// The colors follow the status indicator of the dial actions.
+var flagStyles = map[string]flagStyle{
+	stripbus.FlagMute:    {"Mute", "e04f", "#f66051"},    // volume_off
+	stripbus.FlagSolo:    {"Solo", "e310", "#e8b15f"},    // headset
+	stripbus.FlagMono:    {"Mono", "e32d", "#68e6f8"},    // speaker
+	stripbus.FlagEq:      {"EQ", "e01d", "#296ffd"},      // equalizer
+	stripbus.FlagMc:      {"MC", "e429", "#f66051"},      // tune
+	stripbus.FlagKaraoke: {"Karaoke", "e405", "#70c399"}, // music_note
+}
+
+func (s *instanceSettings) style() flagStyle {
+	if style, ok := flagStyles[s.Flag]; ok {
+		return style
+	}
+	return flagStyles[stripbus.FlagMute]
+}
+
+func (s *instanceSettings) setImages(client *streamdeck.Client, actionContext string) error {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+
+	style := s.style()
+	iconCodePointOn := s.IconCodePointOn
+	if iconCodePointOn == "" {
+		iconCodePointOn = style.iconCodePoint
+	}
+	iconCodePointOff := s.IconCodePointOff
+	if iconCodePointOff == "" {
+		iconCodePointOff = style.iconCodePoint
+	}
+	bgColorOnHex := s.BgColorOn
+	if bgColorOnHex == "" {
+		bgColorOnHex = style.bgColorOn
+	}
+
+	iconColor := color.White
+	borderColor := color.Transparent
+	bgColorOn, _ := colors.ParseHEX(bgColorOnHex)
+	bgColorOff, _ := colors.ParseHEX(s.BgColorOff)
+
+	iconSize := 36
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := offsetX
+	borderWidth := 0
+
+	svgOff, err := fontParams.RenderIconSVG(iconCodePointOff, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOff, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+	svgOn, err := fontParams.RenderIconSVG(iconCodePointOn, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOn, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgOff), streamdeck.HardwareAndSoftware, ptr(stateOff))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgOn), streamdeck.HardwareAndSoftware, ptr(stateOn))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		StripOrBusKind:  "Strip",
+		StripOrBusIndex: 0,
+		Flag:            stripbus.FlagSolo,
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePointOn:  "",
+		IconCodePointOff: "",
+		BgColorOn:        "",
+		BgColorOff:       "#004162",
+	}
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		p.Settings.setImages(client, event.Context)
+
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		p.Settings.setImages(client, event.Context)
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		on, err := stripbus.ToggleFlag(vm, p.Settings.StripOrBusKind, p.Settings.StripOrBusIndex, p.Settings.Flag)
+		if err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+
+		renderCh <- &renderParams{
+			targetContext: event.Context,
+			on:            on,
+		}
+
+		return nil
+	})
+
+	// The flag select in the property inspector asks for the flags that are
+	// valid for the selected strip or bus.
+	action.RegisterHandler(streamdeck.SendToPlugin, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p datasourcePayload
+		if err := json.Unmarshal(event.Payload, &p); err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		if p.Event != datasourceFlags {
+			return nil
+		}
+
+		instProps, ok := shownInstances.Get(event.Context)
+		if !ok {
+			return nil
+		}
+		return sendFlagItems(ctx, client, vm, instProps.Settings)
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	vmEvent := vmevent.Subscribe()
+	go func() {
+		for e := range vmEvent {
+			switch e {
+			case "pdirty":
+				for item := range shownInstances.IterBuffered() {
+					actionContext := item.Key
+					actionSettings := item.Val.Settings
+					go renderCurrentState(client, vm, actionContext, actionSettings)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		for w := range willAppearOrSettingsChangedChan {
+			go renderCurrentState(client, vm, w.actionContext, w.settings)
+
+			// refresh the flag list in case the strip or bus was changed
+			ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+			ctx = sdcontext.WithContext(ctx, w.actionContext)
+			go sendFlagItems(ctx, client, vm, w.settings)
+		}
+	}()
+
+	go func() {
+		for range resync.Subscribe() {
+			for item := range shownInstances.IterBuffered() {
+				go renderCurrentState(client, vm, item.Key, item.Val.Settings)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func sendFlagItems(ctx context.Context, client *streamdeck.Client, vm *voicemeeter.Remote, settings instanceSettings) error {
+	items := []datasourceItem{}
+	for _, flag := range stripbus.SupportedFlagsOf(vm, settings.StripOrBusKind, settings.StripOrBusIndex) {
+		items = append(items, datasourceItem{
+			Label: flagStyles[flag].label,
+			Value: flag,
+		})
+	}
+
+	payload := datasourcePayload{
+		Event: datasourceFlags,
+		Items: items,
+	}
+	if err := client.SendToPropertyInspector(ctx, payload); err != nil {
+		log.Printf("error sending to property inspector: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+func renderCurrentState(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string, settings instanceSettings) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	on, err := stripbus.GetFlag(vm, settings.StripOrBusKind, settings.StripOrBusIndex, settings.Flag)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error getting flag: %w", err))
+		return
+	}
+	renderCh <- &renderParams{
+		targetContext: actionContext,
+		on:            on,
+	}
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	if renderParam.on {
+		client.SetState(ctx, stateOn)
+	} else {
+		client.SetState(ctx, stateOff)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,347 @@
+package toggle_mute
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/resync"
+	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmevent"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID     = "jp.hrko.streamdeck.voicemeeter.toggle-mute"
+	ModeToggle     = "toggle"
+	ModePushToMute = "pushToMute" // momentary mute while the key is held
+	ModePushToTalk = "pushToTalk" // momentary unmute while the key is held
+
+	stateUnmuted = 0
+	stateMuted   = 1
+)
+
+var (
+	shownInstances                  *cmap.MapOf[string, instanceProperty]
+	willAppearOrSettingsChangedChan = make(chan struct {
+		actionContext string
+		settings      instanceSettings
+	}, 32)
+	renderCh chan *renderParams
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	StripOrBusKind       string                             `json:"stripOrBusKind,omitempty"` // "Strip" | "Bus"
+	StripOrBusIndex      int                                `json:"stripOrBusIndex,omitempty"`
+	Mode                 string                             `json:"mode,omitempty"`
+	IconFontParams       graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePointMuted   string                             `json:"iconCodePointMuted,omitempty"`
+	IconCodePointUnmuted string                             `json:"iconCodePointUnmuted,omitempty"`
+	BgColorMuted         string                             `json:"bgColorMuted,omitempty"`
+	BgColorUnmuted       string                             `json:"bgColorUnmuted,omitempty"`
+}
+
+type renderParams struct {
+	targetContext string
+	muted         bool
+}
+
+func (s *instanceSettings) iconCodePoints() (muted, unmuted string) {
+	muted = s.IconCodePointMuted
+	unmuted = s.IconCodePointUnmuted
+	switch s.StripOrBusKind {
+	case "Bus":
+		if muted == "" {
+			muted = "e04f" // volume_off
+		}
+		if unmuted == "" {
+			unmuted = "e050" // volume_up
+		}
+	default:
+		if muted == "" {
+			muted = "e02b" // mic_off
+		}
+		if unmuted == "" {
+			unmuted = "e029" // mic
+		}
+	}
+	return muted, unmuted
+}
+
+func (s *instanceSettings) setImages(client *streamdeck.Client, actionContext string) error {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+
+	iconColor := color.White
+	borderColor := color.Transparent
+	bgColorMuted, _ := colors.ParseHEX(s.BgColorMuted)
+	bgColorUnmuted, _ := colors.ParseHEX(s.BgColorUnmuted)
+	iconCodePointMuted, iconCodePointUnmuted := s.iconCodePoints()
+
+	iconSize := 36
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := offsetX
+	borderWidth := 0
+
+	svgUnmuted, err := fontParams.RenderIconSVG(iconCodePointUnmuted, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorUnmuted, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+	svgMuted, err := fontParams.RenderIconSVG(iconCodePointMuted, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorMuted, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgUnmuted), streamdeck.HardwareAndSoftware, ptr(stateUnmuted))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgMuted), streamdeck.HardwareAndSoftware, ptr(stateMuted))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		StripOrBusKind:  "Strip",
+		StripOrBusIndex: 0,
+		Mode:            ModeToggle,
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePointMuted:   "",
+		IconCodePointUnmuted: "",
+		BgColorMuted:         "#a3302a",
+		BgColorUnmuted:       "#004162",
+	}
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		p.Settings.setImages(client, event.Context)
+
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		p.Settings.setImages(client, event.Context)
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	action.RegisterHandler(streamdeck.KeyDown, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyDownPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		kind := p.Settings.StripOrBusKind
+		index := p.Settings.StripOrBusIndex
+
+		var muted bool
+		switch p.Settings.Mode {
+		case ModePushToMute:
+			muted = true
+			err = stripbus.SetMute(vm, kind, index, muted)
+		case ModePushToTalk:
+			muted = false
+			err = stripbus.SetMute(vm, kind, index, muted)
+		default:
+			muted, err = stripbus.ToggleMute(vm, kind, index)
+		}
+		if err != nil {
+			errreport.Report(ctx, client, fmt.Errorf("error setting mute: %w", err))
+			return err
+		}
+
+		renderCh <- &renderParams{
+			targetContext: event.Context,
+			muted:         muted,
+		}
+
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.KeyUp, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.KeyUpPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		var muted bool
+		switch p.Settings.Mode {
+		case ModePushToMute:
+			muted = false
+		case ModePushToTalk:
+			muted = true
+		default:
+			return nil
+		}
+
+		if err := stripbus.SetMute(vm, p.Settings.StripOrBusKind, p.Settings.StripOrBusIndex, muted); err != nil {
+			errreport.Report(ctx, client, fmt.Errorf("error setting mute: %w", err))
+			return err
+		}
+
+		renderCh <- &renderParams{
+			targetContext: event.Context,
+			muted:         muted,
+		}
+
+		return nil
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	vmEvent := vmevent.Subscribe()
+	go func() {
+		for e := range vmEvent {
+			switch e {
+			case "pdirty":
+				for item := range shownInstances.IterBuffered() {
+					actionContext := item.Key
+					actionSettings := item.Val.Settings
+					go renderCurrentState(client, vm, actionContext, actionSettings)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		for w := range willAppearOrSettingsChangedChan {
+			go renderCurrentState(client, vm, w.actionContext, w.settings)
+		}
+	}()
+
+	go func() {
+		for range resync.Subscribe() {
+			for item := range shownInstances.IterBuffered() {
+				go renderCurrentState(client, vm, item.Key, item.Val.Settings)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func renderCurrentState(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string, settings instanceSettings) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	muted, err := stripbus.GetMute(vm, settings.StripOrBusKind, settings.StripOrBusIndex)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error getting mute: %w", err))
+		return
+	}
+	renderCh <- &renderParams{
+		targetContext: actionContext,
+		muted:         muted,
+	}
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	if renderParam.muted {
+		client.SetState(ctx, stateMuted)
+	} else {
+		client.SetState(ctx, stateUnmuted)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
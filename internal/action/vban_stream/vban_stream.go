@@ -0,0 +1,532 @@
+package vban_stream
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image/color"
+	"log"
+	"strconv"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/resync"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vban"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmevent"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID = "jp.hrko.streamdeck.voicemeeter.vban"
+
+	TargetInStream  = "in"
+	TargetOutStream = "out"
+	TargetEnable    = "enable"
+
+	OperationToggle = "toggle"
+	OperationOn     = "on"
+	OperationOff    = "off"
+
+	// event name of the datasource of the stream select in the property inspector
+	datasourceStreams = "getStreams"
+
+	stateOff = 0
+	stateOn  = 1
+)
+
+var (
+	shownInstances                  *cmap.MapOf[string, instanceProperty]
+	willAppearOrSettingsChangedChan = make(chan struct {
+		actionContext string
+		settings      instanceSettings
+	}, 32)
+	titleMap *cmap.MapOf[string, string] // key: context of action instance
+	renderCh chan *renderParams
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	Target         string                             `json:"target,omitempty"` // "in" | "out" | "enable"
+	StreamIndex    int                                `json:"streamIndex,omitempty"`
+	Operation      string                             `json:"operation,omitempty"` // "toggle" | "on" | "off"
+	IconFontParams graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePoint  string                             `json:"iconCodePoint,omitempty"`
+	BgColorOn      string                             `json:"bgColorOn,omitempty"`
+	BgColorOff     string                             `json:"bgColorOff,omitempty"`
+}
+
+type renderParams struct {
+	targetContext string
+	settings      instanceSettings
+	controller    string
+	on            bool
+	stream        *vban.Stream // nil for the global enable
+}
+
+type datasourceItem struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+type datasourcePayload struct {
+	Event string           `json:"event"`
+	Items []datasourceItem `json:"items,omitempty"`
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		Target:      TargetOutStream,
+		StreamIndex: 0,
+		Operation:   OperationToggle,
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePoint: "",
+		BgColorOn:     "#70c399",
+		BgColorOff:    "#004162",
+	}
+}
+
+func (s *instanceSettings) fontParams() graphics.MaterialSymbolsFontParams {
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+	return fontParams
+}
+
+func (s *instanceSettings) iconCodePoint() string {
+	if s.IconCodePoint != "" {
+		return s.IconCodePoint
+	}
+	switch s.Target {
+	case TargetInStream:
+		return "e2c4" // file_download
+	case TargetOutStream:
+		return "e2c6" // file_upload
+	default:
+		return "eb2f" // lan
+	}
+}
+
+func (s *instanceSettings) setImages(client *streamdeck.Client, actionContext string) error {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	fontParams := s.fontParams()
+	iconCodePoint := s.iconCodePoint()
+
+	iconColor := color.White
+	borderColor := color.Transparent
+	bgColorOn, _ := colors.ParseHEX(s.BgColorOn)
+	bgColorOff, _ := colors.ParseHEX(s.BgColorOff)
+
+	// the icon is placed at the top, leaving room for the stream info title
+	iconSize := 28
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := 4
+	borderWidth := 0
+
+	svgOff, err := fontParams.RenderIconSVG(iconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOff, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+	svgOn, err := fontParams.RenderIconSVG(iconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOn, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgOff), streamdeck.HardwareAndSoftware, ptr(stateOff))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgOn), streamdeck.HardwareAndSoftware, ptr(stateOn))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+// run performs the configured operation and returns the new on/off state.
+func (s *instanceSettings) run(vm *voicemeeter.Remote) (bool, error) {
+	switch s.Target {
+	case TargetEnable:
+		switch s.Operation {
+		case OperationOn:
+			return true, vban.SetEnabled(vm, true)
+		case OperationOff:
+			return false, vban.SetEnabled(vm, false)
+		default:
+			return vban.ToggleEnabled(vm)
+		}
+
+	case TargetInStream, TargetOutStream:
+		switch s.Operation {
+		case OperationOn:
+			return true, vban.SetStreamOn(vm, s.Target, s.StreamIndex, true)
+		case OperationOff:
+			return false, vban.SetStreamOn(vm, s.Target, s.StreamIndex, false)
+		default:
+			return vban.ToggleStreamOn(vm, s.Target, s.StreamIndex)
+		}
+
+	default:
+		return false, fmt.Errorf("unknown target: '%v'", s.Target)
+	}
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	titleMap = cmap.NewOf[string, string]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		titleMap.Remove(event.Context)
+		if p.Controller == "Keypad" {
+			p.Settings.setImages(client, event.Context)
+		}
+
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		titleMap.Remove(event.Context)
+		if p.Controller == "Keypad" {
+			p.Settings.setImages(client, event.Context)
+		}
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		titleMap.Remove(event.Context)
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	action := client.Action(ActionUUID)
+
+	runHandler := func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		instProps, ok := shownInstances.Get(event.Context)
+		if !ok {
+			return nil
+		}
+
+		if _, err := instProps.Settings.run(vm); err != nil {
+			errreport.Report(ctx, client, err)
+			return err
+		}
+		go renderCurrentState(client, vm, event.Context, instProps.Settings, instProps.Controller)
+		return nil
+	}
+	action.RegisterHandler(streamdeck.KeyDown, runHandler)
+	action.RegisterHandler(streamdeck.DialDown, runHandler)
+	action.RegisterHandler(streamdeck.TouchTap, runHandler)
+
+	// Rotating the dial steps through the streams of the same direction.
+	action.RegisterHandler(streamdeck.DialRotate, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DialRotatePayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		if p.Settings.Target == TargetEnable {
+			return nil
+		}
+
+		count, err := vban.StreamCount(vm, p.Settings.Target)
+		if err != nil || count == 0 {
+			return err
+		}
+		index := (p.Settings.StreamIndex + p.Ticks) % count
+		if index < 0 {
+			index += count
+		}
+		p.Settings.StreamIndex = index
+
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		shownInstances.Upsert(event.Context, instanceProperty{}, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+			valueInMap.Settings = p.Settings
+			return valueInMap
+		})
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	// The stream select in the property inspector asks for the streams of
+	// the selected direction.
+	action.RegisterHandler(streamdeck.SendToPlugin, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p datasourcePayload
+		if err := json.Unmarshal(event.Payload, &p); err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		if p.Event != datasourceStreams {
+			return nil
+		}
+
+		instProps, ok := shownInstances.Get(event.Context)
+		if !ok {
+			return nil
+		}
+		return sendStreamItems(ctx, client, vm, instProps.Settings)
+	})
+
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	vmEvent := vmevent.Subscribe()
+	go func() {
+		for e := range vmEvent {
+			switch e {
+			case "pdirty":
+				for item := range shownInstances.IterBuffered() {
+					go renderCurrentState(client, vm, item.Key, item.Val.Settings, item.Val.Controller)
+				}
+			}
+		}
+	}()
+
+	go func() {
+		for w := range willAppearOrSettingsChangedChan {
+			instProps, ok := shownInstances.Get(w.actionContext)
+			if !ok {
+				continue
+			}
+			go renderCurrentState(client, vm, w.actionContext, w.settings, instProps.Controller)
+
+			// refresh the stream list in case the direction was changed
+			ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+			ctx = sdcontext.WithContext(ctx, w.actionContext)
+			go sendStreamItems(ctx, client, vm, w.settings)
+		}
+	}()
+
+	go func() {
+		for range resync.Subscribe() {
+			titleMap.Clear()
+			for item := range shownInstances.IterBuffered() {
+				go renderCurrentState(client, vm, item.Key, item.Val.Settings, item.Val.Controller)
+			}
+		}
+	}()
+
+	return nil
+}
+
+func sendStreamItems(ctx context.Context, client *streamdeck.Client, vm *voicemeeter.Remote, settings instanceSettings) error {
+	items := []datasourceItem{}
+	if settings.Target != TargetEnable {
+		streams, err := vban.GetStreams(vm, settings.Target)
+		if err != nil {
+			errreport.Report(ctx, client, fmt.Errorf("error getting vban streams: %w", err))
+			return err
+		}
+		for _, s := range streams {
+			items = append(items, datasourceItem{
+				Label: fmt.Sprintf("%v: %v (%v)", s.Index, s.Name, s.Address()),
+				Value: strconv.Itoa(s.Index),
+			})
+		}
+	}
+
+	payload := datasourcePayload{
+		Event: datasourceStreams,
+		Items: items,
+	}
+	if err := client.SendToPropertyInspector(ctx, payload); err != nil {
+		log.Printf("error sending to property inspector: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+func renderCurrentState(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string, settings instanceSettings, controller string) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	renderParam := &renderParams{
+		targetContext: actionContext,
+		settings:      settings,
+		controller:    controller,
+	}
+
+	switch settings.Target {
+	case TargetEnable:
+		on, err := vban.GetEnabled(vm)
+		if err != nil {
+			errreport.ReportOnce(ctx, client, fmt.Errorf("error getting vban: %w", err))
+			return
+		}
+		renderParam.on = on
+
+	default:
+		s, err := vban.GetStream(vm, settings.Target, settings.StreamIndex)
+		if err != nil {
+			errreport.ReportOnce(ctx, client, fmt.Errorf("error getting vban stream: %w", err))
+			return
+		}
+		renderParam.on = s.On
+		renderParam.stream = s
+	}
+
+	renderCh <- renderParam
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) error {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	stateStr := "OFF"
+	if renderParam.on {
+		stateStr = "ON"
+	}
+
+	switch renderParam.controller {
+	case "Keypad":
+		state := stateOff
+		if renderParam.on {
+			state = stateOn
+		}
+		if err := client.SetState(ctx, state); err != nil {
+			log.Printf("error setting state: %v\n", err)
+			return err
+		}
+
+		title := "VBAN"
+		if s := renderParam.stream; s != nil {
+			title = fmt.Sprintf("%v\n%v\n%v", s.Name, s.Ip, s.Port)
+		}
+		if lastTitle, ok := titleMap.Get(renderParam.targetContext); !ok || lastTitle != title {
+			if err := client.SetTitle(ctx, title, streamdeck.HardwareAndSoftware, nil); err != nil {
+				log.Printf("error setting title: %v\n", err)
+				return err
+			}
+			titleMap.Set(renderParam.targetContext, title)
+		}
+
+	case "Encoder":
+		payload := struct {
+			Title   *string `json:"title,omitempty"`
+			Icon    *string `json:"icon,omitempty"`
+			State   *string `json:"state,omitempty"`
+			Address *string `json:"address,omitempty"`
+		}{}
+
+		title := "VBAN"
+		address := ""
+		if s := renderParam.stream; s != nil {
+			direction := "IN"
+			if s.Direction == vban.DirectionOut {
+				direction = "OUT"
+			}
+			title = fmt.Sprintf("%v %v: %v", direction, s.Index, s.Name)
+			address = s.Address()
+		}
+		payload.Title = &title
+		payload.State = &stateStr
+		payload.Address = &address
+
+		settings := renderParam.settings
+		fontParams := settings.fontParams()
+		var iconColor color.Color = color.White
+		if renderParam.on {
+			if c, err := colors.ParseHEX(settings.BgColorOn); err == nil {
+				iconColor = c
+			}
+		}
+		svg, err := fontParams.RenderIconSVG(settings.iconCodePoint(), 48, 48, 0, 0, iconColor, color.RGBA{0, 0, 0, 180}, color.Transparent, 1)
+		if err != nil {
+			log.Printf("error creating image: %v\n", err)
+			return err
+		}
+		icon := streamdeck.ImageSvg(svg)
+		payload.Icon = &icon
+
+		if err := client.SetFeedback(ctx, payload); err != nil {
+			log.Printf("error setting feedback: %v\n", err)
+			return err
+		}
+
+	default:
+		log.Printf("unknown controller: %v\n", renderParam.controller)
+		return fmt.Errorf("unknown controller: %v", renderParam.controller)
+	}
+
+	return nil
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
@@ -0,0 +1,278 @@
+package voice_activity
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/fufuok/cmap"
+	"github.com/go-playground/colors"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/errreport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/iconsearch"
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	ActionUUID = "jp.hrko.streamdeck.voicemeeter.voice-activity"
+
+	stateSilent  = 0
+	stateTalking = 1
+)
+
+var (
+	shownInstances                  *cmap.MapOf[string, instanceProperty]
+	willAppearOrSettingsChangedChan = make(chan struct {
+		actionContext string
+		settings      instanceSettings
+	}, 32)
+	watcherMap *cmap.MapOf[string, *levelstream.Subscription] // key: context of action instance
+	renderCh   chan *renderParams
+)
+
+type instanceProperty streamdeck.WillAppearPayload[instanceSettings]
+
+type instanceSettings struct {
+	StripIndex     int                                `json:"stripIndex,omitempty"`
+	Threshold      string                             `json:"threshold,omitempty"` // dB
+	Hangover       string                             `json:"hangover,omitempty"`  // ms
+	IconFontParams graphics.MaterialSymbolsFontParams `json:"iconFontParams,omitempty"`
+	IconCodePoint  string                             `json:"iconCodePoint,omitempty"`
+	BgColorOn      string                             `json:"bgColorOn,omitempty"`
+	BgColorOff     string                             `json:"bgColorOff,omitempty"`
+}
+
+type renderParams struct {
+	targetContext string
+	talking       bool
+}
+
+func defaultInstanceSettings() instanceSettings {
+	return instanceSettings{
+		StripIndex: 0,
+		Threshold:  "-40",
+		Hangover:   "300",
+		IconFontParams: graphics.MaterialSymbolsFontParams{
+			Style: "Rounded",
+			Opsz:  "48",
+			Wght:  "400",
+			Fill:  "0",
+			Grad:  "0",
+		},
+		IconCodePoint: "",
+		BgColorOn:     "#f66051",
+		BgColorOff:    "#004162",
+	}
+}
+
+// gate returns the gate of the settings. A setting that does not parse is
+// replaced with its default, and reported in the error.
+func (s *instanceSettings) gate() (levelstream.Gate, error) {
+	var errs []error
+	threshold, err := strconv.ParseFloat(s.Threshold, 64)
+	if err != nil {
+		errs = append(errs, fmt.Errorf("invalid threshold: '%v'", s.Threshold))
+		threshold = -40
+	}
+	hangover, err := strconv.Atoi(s.Hangover)
+	if err != nil || hangover < 0 {
+		errs = append(errs, fmt.Errorf("invalid hangover: '%v'", s.Hangover))
+		hangover = 300
+	}
+	gate := levelstream.Gate{
+		Threshold: threshold,
+		Hold:      time.Duration(hangover) * time.Millisecond,
+	}
+	return gate, errors.Join(errs...)
+}
+
+func (s *instanceSettings) setImages(client *streamdeck.Client, actionContext string) error {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	fontParams := s.IconFontParams
+	if err := fontParams.Assert(); err != nil {
+		log.Printf("invalid iconFontParams: %v\n", err)
+		fontParams = graphics.MaterialSymbolsFontParams{}
+		fontParams.FillEmptyWithDefault()
+	}
+	iconCodePoint := s.IconCodePoint
+	if iconCodePoint == "" {
+		iconCodePoint = "e029" // mic
+	}
+
+	iconColor, _ := colors.ParseHEX("#ffffff")
+	borderColor, _ := colors.ParseHEX("#00000000")
+	bgColorOn, _ := colors.ParseHEX(s.BgColorOn)
+	bgColorOff, _ := colors.ParseHEX(s.BgColorOff)
+
+	iconSize := 36
+	imgSize := 72
+	offsetX := (imgSize - iconSize) / 2
+	offsetY := offsetX
+	borderWidth := 0
+
+	svgOff, err := fontParams.RenderIconSVG(iconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOff, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+	svgOn, err := fontParams.RenderIconSVG(iconCodePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColorOn, borderWidth)
+	if err != nil {
+		errreport.ReportOnce(ctx, client, fmt.Errorf("error rendering icon: %w", err))
+		return err
+	}
+
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgOff), streamdeck.HardwareAndSoftware, ptr(stateSilent))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	err = client.SetImage(ctx, streamdeck.ImageSvg(svgOn), streamdeck.HardwareAndSoftware, ptr(stateTalking))
+	if err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+
+	return nil
+}
+
+func SetupPreClientRun(client *streamdeck.Client) {
+	action := client.Action(ActionUUID)
+	errreport.Register(action)
+	iconsearch.Register(action)
+	shownInstances = cmap.NewOf[string, instanceProperty]() // key: context of action instance
+	watcherMap = cmap.NewOf[string, *levelstream.Subscription]()
+	renderCh = make(chan *renderParams, 32)
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.DidReceiveSettingsPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+
+		if shownInstances.Has(event.Context) {
+			var dummy instanceProperty
+			shownInstances.Upsert(event.Context, dummy, func(exist bool, valueInMap, _ instanceProperty) instanceProperty {
+				valueInMap.Settings = p.Settings
+				return valueInMap
+			})
+		}
+
+		p.Settings.setImages(client, event.Context)
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[instanceSettings]
+		p.Settings = defaultInstanceSettings()
+		err := json.Unmarshal(event.Payload, &p)
+		if err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		shownInstances.Set(event.Context, instanceProperty(p))
+		p.Settings.setImages(client, event.Context)
+		if err := client.SetSettings(ctx, p.Settings); err != nil {
+			log.Printf("error setting settings: %v\n", err)
+			return err
+		}
+		willAppearOrSettingsChangedChan <- struct {
+			actionContext string
+			settings      instanceSettings
+		}{event.Context, p.Settings}
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		shownInstances.Remove(event.Context)
+		if sub, ok := watcherMap.Get(event.Context); ok {
+			sub.Close()
+			watcherMap.Remove(event.Context)
+		}
+		return nil
+	})
+}
+
+func SetupPostClientRun(client *streamdeck.Client, vm *voicemeeter.Remote) error {
+	go func() {
+		for renderParam := range renderCh {
+			render(client, renderParam)
+		}
+	}()
+
+	go func() {
+		for w := range willAppearOrSettingsChangedChan {
+			if !shownInstances.Has(w.actionContext) {
+				continue
+			}
+			watch(client, vm, w.actionContext, w.settings)
+		}
+	}()
+
+	return nil
+}
+
+// watch subscribes the instance to the level of its strip, replacing the
+// previous subscription. The level stream reads each strip once per tick,
+// however many keys watch it.
+func watch(client *streamdeck.Client, vm *voicemeeter.Remote, actionContext string, settings instanceSettings) {
+	ctx := sdcontext.WithAction(context.Background(), ActionUUID)
+	ctx = sdcontext.WithContext(ctx, actionContext)
+
+	if sub, ok := watcherMap.Get(actionContext); ok {
+		sub.Close()
+		watcherMap.Remove(actionContext)
+	}
+	if settings.StripIndex < 0 || settings.StripIndex >= len(vm.Strip) {
+		errreport.Report(ctx, client, fmt.Errorf("strip %d is not available in this Voicemeeter", settings.StripIndex))
+		return
+	}
+	sub := levelstream.Subscribe(levelstream.Source{Kind: "Strip", Index: settings.StripIndex})
+	watcherMap.Set(actionContext, sub)
+
+	gate, err := settings.gate()
+	if err != nil {
+		errreport.Report(ctx, client, err)
+	}
+	go func() {
+		talking := false
+		renderCh <- &renderParams{targetContext: actionContext, talking: talking}
+		for level := range sub.C {
+			if open := gate.Update(level, time.Now()); open != talking {
+				talking = open
+				renderCh <- &renderParams{targetContext: actionContext, talking: talking}
+			}
+		}
+	}()
+}
+
+func render(client *streamdeck.Client, renderParam *renderParams) {
+	ctx := context.Background()
+	ctx = sdcontext.WithContext(ctx, renderParam.targetContext)
+
+	if renderParam.talking {
+		client.SetState(ctx, stateTalking)
+	} else {
+		client.SetState(ctx, stateSilent)
+	}
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
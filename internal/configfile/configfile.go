@@ -0,0 +1,183 @@
+// Package configfile loads and saves Voicemeeter XML configuration files and
+// keeps timestamped backups of them.
+package configfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+)
+
+const (
+	backupPrefix     = "voicemeeter-"
+	backupTimeLayout = "20060102-150405.000"
+	backupExt        = ".xml"
+
+	// Voicemeeter writes the file asynchronously after Command.Save.
+	saveTimeout      = 3 * time.Second
+	savePollInterval = 100 * time.Millisecond
+)
+
+// backupMu keeps two backups from picking the same name.
+var backupMu sync.Mutex
+
+// CheckPath reports whether path can be passed to Voicemeeter. If mustExist
+// is true, the file must also exist.
+func CheckPath(path string, mustExist bool) error {
+	if path == "" {
+		return fmt.Errorf("file path is empty")
+	}
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("file path '%v' is not absolute", path)
+	}
+	if mustExist {
+		if _, err := os.Stat(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load makes Voicemeeter load the configuration file.
+func Load(vm *voicemeeter.Remote, path string) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+	if err := CheckPath(path, true); err != nil {
+		return err
+	}
+
+	if err := vm.SetString("Command.Load", path); err != nil {
+		log.Printf("error loading config: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// Save makes Voicemeeter save the current configuration to the file and
+// waits until the file has been written.
+func Save(vm *voicemeeter.Remote, path string) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+	if err := CheckPath(path, false); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	before := statFile(path)
+	if err := vm.SetString("Command.Save", path); err != nil {
+		log.Printf("error saving config: %v\n", err)
+		return err
+	}
+
+	// The file is saved once it differs from before and then stays the
+	// same for a poll; Voicemeeter may still be writing before that.
+	var written *fileState
+	timeout := time.After(saveTimeout)
+	ticker := time.NewTicker(savePollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			now := statFile(path)
+			switch {
+			case !now.exists || now.size == 0 || now == before:
+				written = nil
+			case written != nil && now == *written:
+				return nil
+			default:
+				written = &now
+			}
+		case <-timeout:
+			return fmt.Errorf("timed out waiting for '%v' to be saved", path)
+		}
+	}
+}
+
+type fileState struct {
+	exists  bool
+	size    int64
+	modTime time.Time
+}
+
+func statFile(path string) fileState {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileState{}
+	}
+	return fileState{exists: true, size: fi.Size(), modTime: fi.ModTime()}
+}
+
+// Backup saves the current configuration to a timestamped file in dir and
+// removes the oldest backups so that at most keep backups remain.
+// It returns the path of the new backup.
+func Backup(vm *voicemeeter.Remote, dir string, keep int) (string, error) {
+	backupMu.Lock()
+	defer backupMu.Unlock()
+
+	path := backupPath(dir, time.Now())
+	if err := Save(vm, path); err != nil {
+		return "", err
+	}
+	if err := prune(dir, keep); err != nil {
+		log.Printf("error pruning backups: %v\n", err)
+	}
+	return path, nil
+}
+
+// backupPath returns a path in dir named after t that no file has. If the
+// millisecond is taken, the next free one is used, which keeps the names in
+// chronological order.
+func backupPath(dir string, t time.Time) string {
+	for {
+		path := filepath.Join(dir, backupPrefix+t.Format(backupTimeLayout)+backupExt)
+		if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+			return path
+		}
+		t = t.Add(time.Millisecond)
+	}
+}
+
+func prune(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	backups := []string{}
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasPrefix(e.Name(), backupPrefix) || !strings.HasSuffix(e.Name(), backupExt) {
+			continue
+		}
+		backups = append(backups, e.Name())
+	}
+	if len(backups) <= keep {
+		return nil
+	}
+
+	// the timestamp layout sorts chronologically
+	sort.Strings(backups)
+	for _, name := range backups[:len(backups)-keep] {
+		if err := os.Remove(filepath.Join(dir, name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+// Package device lists the audio devices known to Voicemeeter and assigns
+// them to physical strips and buses.
+package device
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+)
+
+const (
+	DriverMme  = "mme"
+	DriverWdm  = "wdm"
+	DriverKs   = "ks"
+	DriverAsio = "asio"
+)
+
+// Device describes an input or output device.
+type Device struct {
+	Name string
+	Type string // "mme" | "wdm" | "ks" | "asio"
+	Hwid string
+}
+
+// List returns the input devices for "Strip" or the output devices for
+// "Bus". If driver is not empty, only devices of that driver type are
+// returned.
+func List(vm *voicemeeter.Remote, stripOrBusKind string, driver string) ([]Device, error) {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return nil, fmt.Errorf("vm is nil")
+	}
+
+	devices := []Device{}
+	switch stripOrBusKind {
+	case "Strip":
+		for i := 0; i < vm.Device.Ins(); i++ {
+			d := vm.Device.Input(i)
+			devices = append(devices, Device{Name: d.Name, Type: d.Type, Hwid: d.Hwid})
+		}
+	case "Bus":
+		for i := 0; i < vm.Device.Outs(); i++ {
+			d := vm.Device.Output(i)
+			devices = append(devices, Device{Name: d.Name, Type: d.Type, Hwid: d.Hwid})
+		}
+	default:
+		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		return nil, fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind)
+	}
+
+	if driver == "" {
+		return devices, nil
+	}
+	filtered := []Device{}
+	for _, d := range devices {
+		if d.Type == driver {
+			filtered = append(filtered, d)
+		}
+	}
+	return filtered, nil
+}
+
+func checkPhysical(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+
+	physCount := 0
+	switch stripOrBusKind {
+	case "Strip":
+		physCount = vm.Kind.PhysIn
+	case "Bus":
+		physCount = vm.Kind.PhysOut
+	default:
+		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		return fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind)
+	}
+	if stripOrBusIndex >= physCount || stripOrBusIndex < 0 {
+		log.Printf("%v %v is not physical\n", stripOrBusKind, stripOrBusIndex)
+		return fmt.Errorf("%v %v is not physical", stripOrBusKind, stripOrBusIndex)
+	}
+	return nil
+}
+
+// GetAssigned returns the name of the device assigned to a physical strip
+// or bus. It is empty if no device is assigned.
+func GetAssigned(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) (string, error) {
+	if err := checkPhysical(vm, stripOrBusKind, stripOrBusIndex); err != nil {
+		return "", err
+	}
+	name, err := vm.GetString(fmt.Sprintf("%v[%d].device.name", stripOrBusKind, stripOrBusIndex))
+	if err != nil {
+		log.Printf("error getting device name: %v\n", err)
+		return "", err
+	}
+	return name, nil
+}
+
+// Assign assigns the device to a physical strip or bus. Voicemeeter accepts
+// ASIO devices only on the first bus.
+func Assign(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int, d Device) error {
+	if err := checkPhysical(vm, stripOrBusKind, stripOrBusIndex); err != nil {
+		return err
+	}
+	switch d.Type {
+	case DriverMme, DriverWdm, DriverKs, DriverAsio:
+	default:
+		return fmt.Errorf("unknown driver type: '%v'", d.Type)
+	}
+
+	param := fmt.Sprintf("%v[%d].device.%v", stripOrBusKind, stripOrBusIndex, d.Type)
+	if err := vm.SetString(param, d.Name); err != nil {
+		log.Printf("error assigning device: %v\n", err)
+		return err
+	}
+	return nil
+}
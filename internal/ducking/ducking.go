@@ -0,0 +1,228 @@
+// Package ducking lowers the gain of a strip or bus while the level of
+// another one is above a threshold, like a sidechain compressor.
+package ducking
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
+)
+
+// A gain moved by more than this while ducking is taken as a change by the
+// user, and becomes the new gain to return to.
+const userChangeTolerance = 0.5
+
+// Fader reads and sets the gains of strips and buses, such as
+// stripbus.Gains.
+type Fader interface {
+	GetGain(kind string, index int) (float64, error)
+	// SetGain sets the gain clamped to the range of the fader, and returns
+	// the gain set.
+	SetGain(kind string, index int, gain float64) (float64, error)
+}
+
+type Rule struct {
+	Trigger   levelstream.Source
+	Threshold float64 // dB
+	Target    levelstream.Source
+	Depth     float64 // dB, positive
+	Attack    time.Duration
+	Hold      time.Duration
+	Release   time.Duration
+}
+
+// Validate reports whether the rule can run.
+func (r *Rule) Validate() error {
+	if r.Trigger == r.Target {
+		return fmt.Errorf("trigger and target are the same")
+	}
+	if r.Depth < 0 {
+		return fmt.Errorf("depth %v is negative", r.Depth)
+	}
+	if r.Attack < 0 || r.Hold < 0 || r.Release < 0 {
+		return fmt.Errorf("times must not be negative")
+	}
+	return nil
+}
+
+// Ducker runs a rule on the level stream.
+type Ducker struct {
+	fader Fader
+
+	mu       sync.Mutex
+	rule     Rule
+	sub      *levelstream.Subscription
+	amount   float64 // 0 = not ducked, 1 = ducked by the full depth
+	baseGain float64 // gain to return to
+	lastGain float64 // gain last written
+	prevGain float64 // gain written before lastGain; reads may lag a write
+	gate     levelstream.Gate
+	lastTick time.Time
+}
+
+func New(fader Fader, rule Rule) *Ducker {
+	return &Ducker{fader: fader, rule: rule}
+}
+
+// Start subscribes to the level of the trigger. It does nothing if the
+// ducker is already running.
+func (d *Ducker) Start() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.sub != nil {
+		return nil
+	}
+	if err := d.rule.Validate(); err != nil {
+		return err
+	}
+	sub := levelstream.Subscribe(d.rule.Trigger)
+	d.sub = sub
+	d.gate = levelstream.Gate{Threshold: d.rule.Threshold, Hold: d.rule.Hold}
+	d.lastTick = time.Now()
+	go func() {
+		for level := range sub.C {
+			d.tick(level, time.Now())
+		}
+	}()
+	return nil
+}
+
+// Stop unsubscribes and restores the gain of the target at once.
+func (d *Ducker) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.sub == nil {
+		return
+	}
+	d.sub.Close()
+	d.sub = nil
+	d.restore()
+}
+
+// Running reports whether the ducker is started.
+func (d *Ducker) Running() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.sub != nil
+}
+
+// SetRule replaces the rule. A running ducker restarts on the new rule.
+func (d *Ducker) SetRule(rule Rule) error {
+	d.mu.Lock()
+	running := d.sub != nil
+	d.mu.Unlock()
+
+	if running {
+		d.Stop()
+	}
+	d.mu.Lock()
+	d.rule = rule
+	d.mu.Unlock()
+	if running {
+		return d.Start()
+	}
+	return nil
+}
+
+// Rule returns the current rule.
+func (d *Ducker) Rule() Rule {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rule
+}
+
+// Depth returns how far the target is ducked now, in dB.
+func (d *Ducker) Depth() float64 {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.rule.Depth * d.amount
+}
+
+func (d *Ducker) tick(level float64, now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.sub == nil {
+		return
+	}
+	dt := now.Sub(d.lastTick)
+	d.lastTick = now
+
+	target := 0.0
+	if d.gate.Update(level, now) {
+		target = 1
+	}
+
+	if d.amount == 0 && target == 0 {
+		return
+	}
+	if d.amount == 0 {
+		// about to duck; remember where to return to
+		gain, err := d.fader.GetGain(d.rule.Target.Kind, d.rule.Target.Index)
+		if err != nil {
+			return
+		}
+		d.baseGain = gain
+		d.lastGain = gain
+		d.prevGain = gain
+	} else if gain, err := d.fader.GetGain(d.rule.Target.Kind, d.rule.Target.Index); err == nil && d.changedByUser(gain) {
+		d.baseGain = gain + d.rule.Depth*d.amount
+		d.lastGain = gain
+		d.prevGain = gain
+	}
+
+	d.amount = approach(d.amount, target, dt, d.rule.Attack, d.rule.Release)
+	d.apply()
+}
+
+// approach moves amount toward target, taking attack to go from 0 to 1 and
+// release to go back.
+func approach(amount, target float64, dt, attack, release time.Duration) float64 {
+	switch {
+	case target > amount:
+		if attack <= 0 {
+			return target
+		}
+		return math.Min(target, amount+float64(dt)/float64(attack))
+	case target < amount:
+		if release <= 0 {
+			return target
+		}
+		return math.Max(target, amount-float64(dt)/float64(release))
+	default:
+		return amount
+	}
+}
+
+// apply must be called with mu held.
+func (d *Ducker) apply() {
+	gain := d.baseGain - d.rule.Depth*d.amount
+	if math.Abs(gain-d.lastGain) < 0.05 && d.amount != 0 {
+		return
+	}
+	set, err := d.fader.SetGain(d.rule.Target.Kind, d.rule.Target.Index, gain)
+	if err != nil {
+		return
+	}
+	d.prevGain = d.lastGain
+	d.lastGain = set
+}
+
+// changedByUser must be called with mu held.
+func (d *Ducker) changedByUser(gain float64) bool {
+	return math.Abs(gain-d.lastGain) > userChangeTolerance && math.Abs(gain-d.prevGain) > userChangeTolerance
+}
+
+// restore must be called with mu held.
+func (d *Ducker) restore() {
+	if d.amount == 0 {
+		return
+	}
+	d.amount = 0
+	d.fader.SetGain(d.rule.Target.Kind, d.rule.Target.Index, d.baseGain)
+}
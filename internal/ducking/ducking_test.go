@@ -0,0 +1,211 @@
+package ducking
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
+)
+
+// fakeFader keeps gains in memory, clamped to the range of a Voicemeeter
+// fader.
+type fakeFader struct {
+	mu    sync.Mutex
+	gains map[levelstream.Source]float64
+}
+
+func newFakeFader(gains map[levelstream.Source]float64) *fakeFader {
+	return &fakeFader{gains: gains}
+}
+
+func (f *fakeFader) GetGain(kind string, index int) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	gain, ok := f.gains[levelstream.Source{Kind: kind, Index: index}]
+	if !ok {
+		return 0, fmt.Errorf("%v %v does not exist", kind, index)
+	}
+	return gain, nil
+}
+
+func (f *fakeFader) SetGain(kind string, index int, gain float64) (float64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	source := levelstream.Source{Kind: kind, Index: index}
+	if _, ok := f.gains[source]; !ok {
+		return 0, fmt.Errorf("%v %v does not exist", kind, index)
+	}
+	gain = max(-60, min(12, gain))
+	f.gains[source] = gain
+	return gain, nil
+}
+
+func (f *fakeFader) gain(t *testing.T, source levelstream.Source) float64 {
+	t.Helper()
+	gain, err := f.GetGain(source.Kind, source.Index)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return gain
+}
+
+var (
+	mic   = levelstream.Source{Kind: "Strip", Index: 0}
+	music = levelstream.Source{Kind: "Strip", Index: 5}
+)
+
+func TestRuleValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rule    Rule
+		wantErr bool
+	}{
+		{name: "valid", rule: Rule{Trigger: mic, Target: music, Depth: 12}},
+		{name: "same strip", rule: Rule{Trigger: mic, Target: mic, Depth: 12}, wantErr: true},
+		{name: "negative depth", rule: Rule{Trigger: mic, Target: music, Depth: -1}, wantErr: true},
+		{name: "negative time", rule: Rule{Trigger: mic, Target: music, Release: -time.Millisecond}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.rule.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDucker(t *testing.T) {
+	const loud, quiet = -10.0, -60.0
+	type tick struct {
+		after    time.Duration // since start
+		level    float64
+		userGain *float64 // moves the target fader before the tick
+		want     float64  // gain of the target after the tick
+	}
+	ptr := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name     string
+		baseGain float64
+		ticks    []tick
+	}{
+		{
+			name: "attack and release",
+			ticks: []tick{
+				{after: 50 * time.Millisecond, level: quiet, want: 0},
+				{after: 100 * time.Millisecond, level: loud, want: -6},
+				{after: 150 * time.Millisecond, level: loud, want: -12},
+				{after: 200 * time.Millisecond, level: loud, want: -12},
+				{after: 250 * time.Millisecond, level: quiet, want: -6},
+				{after: 300 * time.Millisecond, level: quiet, want: 0},
+			},
+		},
+		{
+			name: "fader moved while ducked is kept",
+			ticks: []tick{
+				{after: 100 * time.Millisecond, level: loud, want: -12},
+				{after: 150 * time.Millisecond, level: loud, userGain: ptr(-20), want: -20},
+				{after: 200 * time.Millisecond, level: quiet, want: -14},
+				{after: 250 * time.Millisecond, level: quiet, want: -8},
+			},
+		},
+		{
+			name:     "bottom of the fader is not a move by the user",
+			baseGain: -55,
+			ticks: []tick{
+				{after: 100 * time.Millisecond, level: loud, want: -60},
+				{after: 150 * time.Millisecond, level: loud, want: -60},
+				{after: 250 * time.Millisecond, level: quiet, want: -55},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fader := newFakeFader(map[levelstream.Source]float64{mic: 0, music: tt.baseGain})
+			d := New(fader, Rule{
+				Trigger:   mic,
+				Threshold: -30,
+				Target:    music,
+				Depth:     12,
+				Attack:    100 * time.Millisecond,
+				Release:   100 * time.Millisecond,
+			})
+			if err := d.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer d.Stop()
+
+			start := time.Now()
+			d.mu.Lock()
+			d.lastTick = start
+			d.mu.Unlock()
+			// the fader starts at 0 dB after the first step of the attack
+			d.tick(quiet, start.Add(50*time.Millisecond))
+
+			for _, tk := range tt.ticks {
+				if tk.userGain != nil {
+					fader.SetGain(music.Kind, music.Index, *tk.userGain)
+				}
+				d.tick(tk.level, start.Add(50*time.Millisecond+tk.after))
+				if got := fader.gain(t, music); math.Abs(got-tk.want) > 1e-9 {
+					t.Fatalf("after %v: gain = %v, want %v", tk.after, got, tk.want)
+				}
+			}
+		})
+	}
+}
+
+func TestDuckerStopRestores(t *testing.T) {
+	fader := newFakeFader(map[levelstream.Source]float64{mic: 0, music: -3})
+	d := New(fader, Rule{Trigger: mic, Threshold: -30, Target: music, Depth: 12})
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	d.tick(-10, now)
+	if got := fader.gain(t, music); got != -15 {
+		t.Fatalf("gain while ducked = %v, want -15", got)
+	}
+	if got := d.Depth(); got != 12 {
+		t.Errorf("Depth() = %v, want 12", got)
+	}
+
+	d.Stop()
+	if d.Running() {
+		t.Error("Running() = true after Stop")
+	}
+	if got := fader.gain(t, music); got != -3 {
+		t.Errorf("gain after Stop = %v, want -3", got)
+	}
+	if got := d.Depth(); got != 0 {
+		t.Errorf("Depth() after Stop = %v, want 0", got)
+	}
+}
+
+func TestDuckerSetRule(t *testing.T) {
+	fader := newFakeFader(map[levelstream.Source]float64{mic: 0, music: 0})
+	d := New(fader, Rule{Trigger: mic, Target: music, Depth: 12})
+	if err := d.SetRule(Rule{Trigger: mic, Target: mic}); err != nil {
+		t.Errorf("SetRule() on a stopped ducker error = %v, want nil", err)
+	}
+	if err := d.Start(); err == nil {
+		t.Error("Start() with an invalid rule error = nil")
+	}
+
+	valid := Rule{Trigger: mic, Target: music, Depth: 6}
+	if err := d.SetRule(valid); err != nil {
+		t.Fatal(err)
+	}
+	if err := d.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Stop()
+	if err := d.SetRule(Rule{Trigger: music, Target: music}); err == nil {
+		t.Error("SetRule() with an invalid rule on a running ducker error = nil")
+	}
+	if d.Running() {
+		t.Error("Running() = true after an invalid rule")
+	}
+}
@@ -0,0 +1,75 @@
+package ducking
+
+import (
+	"sync"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
+)
+
+// A hold ducks a strip or bus for as long as at least one owner holds it,
+// such as a push-to-talk key while it is talking. The target is lowered by
+// the deepest depth among its owners. Changes are applied relative to the
+// current gain, so that a fader moved while ducked keeps the move, and owners
+// releasing in any order return the target to where it would have been.
+type hold struct {
+	depths  map[any]float64 // key: owner
+	applied float64         // dB the target is lowered by now
+}
+
+var (
+	holdsMu sync.Mutex
+	holds   = map[levelstream.Source]*hold{}
+)
+
+// Hold ducks the target by depth dB on behalf of owner, replacing an earlier
+// depth of the same owner.
+func Hold(fader Fader, target levelstream.Source, owner any, depth float64) error {
+	holdsMu.Lock()
+	defer holdsMu.Unlock()
+
+	h, ok := holds[target]
+	if !ok {
+		h = &hold{depths: map[any]float64{}}
+		holds[target] = h
+	}
+	h.depths[owner] = max(depth, 0)
+	return h.apply(fader, target)
+}
+
+// Release ends the duck of owner on the target.
+func Release(fader Fader, target levelstream.Source, owner any) error {
+	holdsMu.Lock()
+	defer holdsMu.Unlock()
+
+	h, ok := holds[target]
+	if !ok {
+		return nil
+	}
+	delete(h.depths, owner)
+	return h.apply(fader, target)
+}
+
+// apply must be called with holdsMu held.
+func (h *hold) apply(fader Fader, target levelstream.Source) error {
+	depth := 0.0
+	for _, d := range h.depths {
+		depth = max(depth, d)
+	}
+	if depth != h.applied {
+		gain, err := fader.GetGain(target.Kind, target.Index)
+		if err != nil {
+			return err
+		}
+		// the gain stops at the end of the fader; remember how far it
+		// actually went, so that releasing gives back exactly that
+		newGain, err := fader.SetGain(target.Kind, target.Index, gain+h.applied-depth)
+		if err != nil {
+			return err
+		}
+		h.applied -= newGain - gain
+	}
+	if len(h.depths) == 0 {
+		delete(holds, target)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package ducking
+
+import (
+	"testing"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
+)
+
+func TestHold(t *testing.T) {
+	type step struct {
+		owner    string
+		depth    float64 // 0 releases
+		userGain *float64
+		want     float64
+	}
+	ptr := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name     string
+		baseGain float64
+		steps    []step
+	}{
+		{
+			name: "deepest owner wins",
+			steps: []step{
+				{owner: "a", depth: 6, want: -6},
+				{owner: "b", depth: 10, want: -10},
+				{owner: "b", want: -6},
+				{owner: "a", want: 0},
+			},
+		},
+		{
+			name: "released in any order",
+			steps: []step{
+				{owner: "a", depth: 6, want: -6},
+				{owner: "b", depth: 10, want: -10},
+				{owner: "a", want: -10},
+				{owner: "b", want: 0},
+			},
+		},
+		{
+			name: "depth of the same owner replaced",
+			steps: []step{
+				{owner: "a", depth: 6, want: -6},
+				{owner: "a", depth: 3, want: -3},
+				{owner: "a", want: 0},
+			},
+		},
+		{
+			name: "fader moved while held is kept",
+			steps: []step{
+				{owner: "a", depth: 6, want: -6},
+				{owner: "a", userGain: ptr(-10), depth: 6, want: -10},
+				{owner: "a", want: -4},
+			},
+		},
+		{
+			name:     "bottom of the fader",
+			baseGain: -55,
+			steps: []step{
+				{owner: "a", depth: 10, want: -60},
+				{owner: "a", want: -55},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := levelstream.Source{Kind: "Bus", Index: 1}
+			fader := newFakeFader(map[levelstream.Source]float64{target: tt.baseGain})
+			for i, s := range tt.steps {
+				if s.userGain != nil {
+					fader.SetGain(target.Kind, target.Index, *s.userGain)
+				}
+				var err error
+				if s.depth > 0 {
+					err = Hold(fader, target, s.owner, s.depth)
+				} else {
+					err = Release(fader, target, s.owner)
+				}
+				if err != nil {
+					t.Fatalf("step %d: %v", i, err)
+				}
+				if got := fader.gain(t, target); got != s.want {
+					t.Fatalf("step %d: gain = %v, want %v", i, got, s.want)
+				}
+			}
+
+			holdsMu.Lock()
+			defer holdsMu.Unlock()
+			if _, ok := holds[target]; ok {
+				t.Error("hold is kept after every owner released")
+			}
+		})
+	}
+}
+
+func TestHoldMissingTarget(t *testing.T) {
+	target := levelstream.Source{Kind: "Strip", Index: 9}
+	fader := newFakeFader(map[levelstream.Source]float64{})
+	if err := Hold(fader, target, "a", 6); err == nil {
+		t.Error("Hold() on a missing strip error = nil")
+	}
+	if err := Release(fader, target, "a"); err != nil {
+		t.Errorf("Release() error = %v, want nil", err)
+	}
+}
@@ -0,0 +1,264 @@
+// Package errreport shows errors to the user instead of only logging them:
+// the key or touch strip shows an alert and an error overlay for a moment,
+// and the property inspector shows the message until the error is cleared.
+package errreport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/fufuok/cmap"
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	// OverlayDuration is how long the error overlay stays before the action
+	// draws itself again.
+	OverlayDuration = 3 * time.Second
+
+	// event name of the message to the property inspector, shown by
+	// property_inspector/js/error-message.js
+	eventShowError = "showError"
+
+	controllerEncoder = "Encoder"
+)
+
+var (
+	controllerMap = cmap.NewOf[string, string]()     // key: context of action instance
+	errorMap      = cmap.NewOf[string, errorEntry]() // key: context of action instance
+	overlayMap    = cmap.NewOf[string, time.Time]()  // key: context of action instance, value: time the overlay goes away
+)
+
+type errorEntry struct {
+	message string
+	// restoring is set while the settings asked for after the overlay are on
+	// their way, and restored once they arrived. The settings do not clear
+	// the message, and the action finding the same error again on them does
+	// not report it twice.
+	restoring bool
+	restored  bool
+}
+
+// iconSettings holds the settings every action with an icon shares.
+type iconSettings struct {
+	IconFontParams  json.RawMessage `json:"iconFontParams,omitempty"`
+	IconFontParams1 json.RawMessage `json:"iconFontParams1,omitempty"`
+}
+
+type errorPayload struct {
+	Event   string `json:"event"`
+	Message string `json:"message"`
+}
+
+// Register tracks the instances of the action. It must be called before the
+// action registers its own handlers, so that a settings change clears the
+// error before the action checks the new settings.
+func Register(action *streamdeck.Action) {
+	action.RegisterHandler(streamdeck.WillAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p streamdeck.WillAppearPayload[iconSettings]
+		if err := json.Unmarshal(event.Payload, &p); err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		controllerMap.Set(event.Context, p.Controller)
+		ReportOnce(ctx, client, p.Settings.check())
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.WillDisappear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		controllerMap.Remove(event.Context)
+		errorMap.Remove(event.Context)
+		overlayMap.Remove(event.Context)
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.DidReceiveSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		if e, ok := errorMap.Get(event.Context); ok && e.restoring {
+			e.restoring = false
+			e.restored = true
+			errorMap.Set(event.Context, e)
+			return nil
+		}
+		Clear(ctx, client)
+
+		var p streamdeck.DidReceiveSettingsPayload[iconSettings]
+		if err := json.Unmarshal(event.Payload, &p); err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		Report(ctx, client, p.Settings.check())
+		return nil
+	})
+
+	action.RegisterHandler(streamdeck.PropertyInspectorDidAppear, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		e, _ := errorMap.Get(event.Context)
+		return sendMessage(ctx, client, e.message)
+	})
+
+	// the same error is reported again once the user does something
+	for _, eventName := range []string{streamdeck.KeyDown, streamdeck.DialDown, streamdeck.DialRotate, streamdeck.TouchTap} {
+		action.RegisterHandler(eventName, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+			if e, ok := errorMap.Get(event.Context); ok && e.restored {
+				e.restored = false
+				errorMap.Set(event.Context, e)
+			}
+			return nil
+		})
+	}
+}
+
+// Report logs err and shows it on the instance in ctx. ctx must carry the
+// action and the context of the instance, as the contexts passed to event
+// handlers do.
+func Report(ctx context.Context, client *streamdeck.Client, err error) {
+	if err == nil {
+		return
+	}
+	log.Printf("error: %v\n", err)
+
+	actionContext := sdcontext.Context(ctx)
+	message := err.Error()
+	last, _ := errorMap.Get(actionContext)
+	errorMap.Set(actionContext, errorEntry{message: message})
+	if (last.restoring || last.restored) && last.message == message {
+		return
+	}
+	show(ctx, client, actionContext, message)
+}
+
+// ReportOnce is like Report, but does nothing more than logging while the
+// same error is shown. It is meant for render loops, which find the same
+// error on every refresh.
+func ReportOnce(ctx context.Context, client *streamdeck.Client, err error) {
+	if err == nil {
+		return
+	}
+	actionContext := sdcontext.Context(ctx)
+	if last, ok := errorMap.Get(actionContext); ok && last.message == err.Error() {
+		return
+	}
+	Report(ctx, client, err)
+}
+
+// Clear forgets the error of the instance in ctx and removes the message from
+// the property inspector.
+func Clear(ctx context.Context, client *streamdeck.Client) {
+	if _, ok := errorMap.Pop(sdcontext.Context(ctx)); !ok {
+		return
+	}
+	sendMessage(ctx, client, "")
+}
+
+// Showing reports whether the error overlay is on the instance. Actions that
+// redraw themselves periodically skip drawing meanwhile, so that the overlay
+// stays for OverlayDuration.
+func Showing(actionContext string) bool {
+	until, ok := overlayMap.Get(actionContext)
+	return ok && time.Now().Before(until)
+}
+
+func show(ctx context.Context, client *streamdeck.Client, actionContext string, message string) {
+	client.ShowAlert(ctx)
+	sendMessage(ctx, client, message)
+	overlayMap.Set(actionContext, time.Now().Add(OverlayDuration))
+	if err := drawOverlay(ctx, client, actionContext, message); err != nil {
+		overlayMap.Remove(actionContext)
+		return
+	}
+
+	// the actions draw themselves on receiving their settings
+	restoreCtx := sdcontext.WithAction(context.Background(), sdcontext.Action(ctx))
+	restoreCtx = sdcontext.WithContext(restoreCtx, actionContext)
+	time.AfterFunc(OverlayDuration, func() {
+		if e, ok := errorMap.Get(actionContext); ok && e.message == message {
+			e.restoring = true
+			errorMap.Set(actionContext, e)
+		}
+		if err := client.GetSettings(restoreCtx); err != nil {
+			log.Printf("error getting settings: %v\n", err)
+		}
+	})
+}
+
+// check reports the settings the actions replace with the defaults, which
+// would otherwise go unnoticed.
+func (s *iconSettings) check() error {
+	for _, raw := range []json.RawMessage{s.IconFontParams, s.IconFontParams1} {
+		if raw == nil {
+			continue
+		}
+		// the actions fill the missing params with their defaults
+		p := graphics.MaterialSymbolsFontParams{}
+		p.FillEmptyWithDefault()
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return fmt.Errorf("invalid iconFontParams: %w", err)
+		}
+		if err := p.Assert(); err != nil {
+			return fmt.Errorf("invalid iconFontParams: %w", err)
+		}
+	}
+	return nil
+}
+
+func sendMessage(ctx context.Context, client *streamdeck.Client, message string) error {
+	payload := errorPayload{
+		Event:   eventShowError,
+		Message: message,
+	}
+	if err := client.SendToPropertyInspector(ctx, payload); err != nil {
+		log.Printf("error sending to property inspector: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+func drawOverlay(ctx context.Context, client *streamdeck.Client, actionContext string, message string) error {
+	overlay := graphics.NewErrorOverlay()
+
+	controller, _ := controllerMap.Get(actionContext)
+	if controller == controllerEncoder {
+		overlay.Width = 48
+		overlay.Height = 48
+		img, err := overlay.Render("")
+		if err != nil {
+			log.Printf("error creating image: %v\n", err)
+			return err
+		}
+		imgBase64, err := streamdeck.Image(img)
+		if err != nil {
+			log.Printf("error creating image: %v\n", err)
+			return err
+		}
+		payload := map[string]any{
+			"title": map[string]string{"value": message, "color": "#ff5252"},
+			"icon":  imgBase64,
+		}
+		if err := client.SetFeedback(ctx, payload); err != nil {
+			log.Printf("error setting feedback: %v\n", err)
+			return err
+		}
+		return nil
+	}
+
+	img, err := overlay.Render(message)
+	if err != nil {
+		log.Printf("error creating image: %v\n", err)
+		return err
+	}
+	imgBase64, err := streamdeck.Image(img)
+	if err != nil {
+		log.Printf("error creating image: %v\n", err)
+		return err
+	}
+	if err := client.SetImage(ctx, imgBase64, streamdeck.HardwareAndSoftware, nil); err != nil {
+		log.Printf("error setting image: %v\n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+// Package globalsettings keeps a copy of the global settings of the plugin,
+// so that actions can store their own entries in them next to the entries
+// written by the property inspectors.
+package globalsettings
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/hrko/streamdeck"
+	sdcontext "github.com/hrko/streamdeck/context"
+)
+
+var (
+	mu       sync.Mutex
+	settings = map[string]json.RawMessage{} // key: name of the entry
+	received bool                           // whether Update has been called
+)
+
+// Update replaces the copy with the settings received from Stream Deck.
+func Update(raw json.RawMessage) error {
+	s := map[string]json.RawMessage{}
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &s); err != nil {
+			return err
+		}
+	}
+	mu.Lock()
+	settings = s
+	received = true
+	mu.Unlock()
+	return nil
+}
+
+// Get decodes the entry into v. It reports false if there is no entry.
+func Get(key string, v any) (bool, error) {
+	mu.Lock()
+	raw, ok := settings[key]
+	mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	return true, json.Unmarshal(raw, v)
+}
+
+// Set stores v as the entry and saves the global settings, keeping the
+// other entries. It fails until the global settings have been received, as
+// saving would drop the entries not received yet.
+func Set(ctx context.Context, client *streamdeck.Client, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !received {
+		return fmt.Errorf("global settings not received yet")
+	}
+	settings[key] = raw
+	ctx = sdcontext.WithContext(ctx, client.UUID())
+	return client.SetGlobalSettings(ctx, settings)
+}
@@ -0,0 +1,90 @@
+// Package iconsearch answers the icon search of the property inspector
+// (property_inspector/js/icon-search.js) with the names of matching Material
+// Symbols and previews of them.
+package iconsearch
+
+import (
+	"context"
+	"encoding/json"
+	"image/color"
+	"log"
+
+	"github.com/hrko/streamdeck"
+
+	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
+)
+
+const (
+	// event name of the search request and its result
+	eventSearchIcons = "searchIcons"
+
+	maxResults  = 48
+	previewSize = 24
+)
+
+type searchRequest struct {
+	Event string `json:"event"`
+	Query string `json:"query"`
+}
+
+type searchItem struct {
+	Name      string `json:"name"`
+	CodePoint string `json:"codePoint"`
+	SVG       string `json:"svg,omitempty"`
+}
+
+type searchResult struct {
+	Event string       `json:"event"`
+	Query string       `json:"query"`
+	Items []searchItem `json:"items"`
+}
+
+// Register answers the searches of the property inspector of the action.
+func Register(action *streamdeck.Action) {
+	action.RegisterHandler(streamdeck.SendToPlugin, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
+		var p searchRequest
+		if err := json.Unmarshal(event.Payload, &p); err != nil {
+			log.Printf("error unmarshaling payload: %v\n", err)
+			return err
+		}
+		if p.Event != eventSearchIcons {
+			return nil
+		}
+
+		// answered aside so that typing does not hold up the other events;
+		// the property inspector drops the answers to older queries
+		go func() {
+			payload := searchResult{
+				Event: eventSearchIcons,
+				Query: p.Query,
+				Items: search(p.Query),
+			}
+			if err := client.SendToPropertyInspector(ctx, payload); err != nil {
+				log.Printf("error sending to property inspector: %v\n", err)
+			}
+		}()
+		return nil
+	})
+}
+
+func search(query string) []searchItem {
+	// the previews are drawn with a font already in use, in the style the
+	// actions default to if it is; the search does not wait for a fetch
+	fontParams, preview := graphics.LoadedMaterialSymbolsFontParams(graphics.MaterialSymbolsFontParams{Style: "Rounded"})
+
+	items := []searchItem{}
+	for _, icon := range graphics.SearchIcons(query, maxResults) {
+		item := searchItem{Name: icon.Name, CodePoint: icon.CodePoint}
+		if preview {
+			svg, err := fontParams.RenderIconSVG(icon.CodePoint, previewSize, previewSize, 0, 0, color.White, color.Transparent, color.Transparent, 0)
+			if err != nil {
+				// the names are still worth showing
+				log.Printf("error rendering icon preview: %v\n", err)
+				preview = false
+			}
+			item.SVG = svg
+		}
+		items = append(items, item)
+	}
+	return items
+}
@@ -0,0 +1,21 @@
+package levelstream
+
+import "time"
+
+// Gate opens when the level goes above the threshold, and closes once the
+// level has stayed at or below it for the hold time.
+type Gate struct {
+	Threshold float64 // dB
+	Hold      time.Duration
+
+	lastAbove time.Time
+}
+
+// Update feeds a level to the gate and reports whether it is open.
+func (g *Gate) Update(level float64, now time.Time) bool {
+	if level > g.Threshold {
+		g.lastAbove = now
+		return true
+	}
+	return !g.lastAbove.IsZero() && now.Sub(g.lastAbove) < g.Hold
+}
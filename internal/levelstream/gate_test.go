@@ -0,0 +1,67 @@
+package levelstream
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGate(t *testing.T) {
+	t0 := time.Now()
+	type update struct {
+		after time.Duration // since t0
+		level float64
+		want  bool
+	}
+	tests := []struct {
+		name    string
+		hold    time.Duration
+		updates []update
+	}{
+		{
+			name: "closed until above",
+			hold: 100 * time.Millisecond,
+			updates: []update{
+				{0, -60, false},
+				{10 * time.Millisecond, -30, false}, // at the threshold is not above
+				{20 * time.Millisecond, -29, true},
+			},
+		},
+		{
+			name: "held open below",
+			hold: 100 * time.Millisecond,
+			updates: []update{
+				{0, -10, true},
+				{50 * time.Millisecond, -60, true},
+				{99 * time.Millisecond, -60, true},
+				{100 * time.Millisecond, -60, false},
+			},
+		},
+		{
+			name: "hold restarts when above again",
+			hold: 100 * time.Millisecond,
+			updates: []update{
+				{0, -10, true},
+				{80 * time.Millisecond, -10, true},
+				{150 * time.Millisecond, -60, true},
+				{180 * time.Millisecond, -60, false},
+			},
+		},
+		{
+			name: "no hold",
+			updates: []update{
+				{0, -10, true},
+				{time.Millisecond, -60, false},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := Gate{Threshold: -30, Hold: tt.hold}
+			for _, u := range tt.updates {
+				if got := g.Update(u.level, t0.Add(u.after)); got != u.want {
+					t.Errorf("Update(%v) at %v = %v, want %v", u.level, u.after, got, u.want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+// Package levelstream shares one level poll among all subscribers, so that
+// any number of rules and indicators watching the same strip or bus cost a
+// single read per tick.
+package levelstream
+
+import (
+	"log"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Interval is the poll interval, the same as the level meters of the dial
+// actions.
+const Interval = time.Second / 15
+
+// Source identifies a strip or bus.
+type Source struct {
+	Kind  string // "Strip" | "Bus"
+	Index int
+}
+
+// Subscription receives the peak level of its source in dB every tick.
+// If the receiver falls behind, older values are dropped.
+type Subscription struct {
+	C      <-chan float64
+	c      chan float64
+	source Source
+	levels []float64 // guarded by mu
+}
+
+var (
+	mu        sync.Mutex
+	subs      = map[*Subscription]struct{}{}
+	startOnce sync.Once
+)
+
+// Start starts polling, calling read for the levels of the channels of each
+// source subscribed to. Ticks without subscribers cost nothing.
+func Start(read func(source Source) ([]float64, error)) {
+	startOnce.Do(func() {
+		go run(read)
+	})
+}
+
+// Subscribe starts delivering the level of the source.
+func Subscribe(source Source) *Subscription {
+	c := make(chan float64, 1)
+	s := &Subscription{C: c, c: c, source: source}
+
+	mu.Lock()
+	defer mu.Unlock()
+	subs[s] = struct{}{}
+	return s
+}
+
+// Close stops the delivery and closes C.
+func (s *Subscription) Close() {
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := subs[s]; !ok {
+		return
+	}
+	delete(subs, s)
+	close(s.c)
+}
+
+// Levels returns the levels of the channels read on the last tick, or nil
+// before the first one. Meters that redraw on their own clock read this
+// instead of C.
+func (s *Subscription) Levels() []float64 {
+	mu.Lock()
+	defer mu.Unlock()
+	return s.levels
+}
+
+func run(read func(source Source) ([]float64, error)) {
+	for range time.Tick(Interval) {
+		mu.Lock()
+		sources := []Source{}
+		for s := range subs {
+			if !slices.Contains(sources, s.source) {
+				sources = append(sources, s.source)
+			}
+		}
+		mu.Unlock()
+		if len(sources) == 0 {
+			continue
+		}
+
+		levelsOf := map[Source][]float64{}
+		for _, source := range sources {
+			levels, err := read(source)
+			if err != nil {
+				log.Printf("error getting levels: %v\n", err)
+				continue
+			}
+			levelsOf[source] = levels
+		}
+
+		mu.Lock()
+		for s := range subs {
+			levels, ok := levelsOf[s.source]
+			if !ok {
+				continue
+			}
+			s.levels = levels
+			peak := slices.Max(levels)
+			// drop the value the receiver has not taken yet
+			select {
+			case <-s.c:
+			default:
+			}
+			s.c <- peak
+		}
+		mu.Unlock()
+	}
+}
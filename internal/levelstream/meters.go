@@ -0,0 +1,46 @@
+package levelstream
+
+import (
+	"sync"
+)
+
+// Meters keeps one subscription per level meter, such as the meter on a key
+// or dial, and follows the source each meter shows.
+type Meters struct {
+	mu   sync.Mutex
+	subs map[string]*Subscription // key: id of the meter
+}
+
+func NewMeters() *Meters {
+	return &Meters{subs: map[string]*Subscription{}}
+}
+
+// Levels returns the levels of the source read on the last tick. The meter
+// subscribes on first use and when its source changes, so the first call
+// returns nil.
+func (m *Meters) Levels(id string, source Source) []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sub, ok := m.subs[id]
+	if ok && sub.source != source {
+		sub.Close()
+		ok = false
+	}
+	if !ok {
+		sub = Subscribe(source)
+		m.subs[id] = sub
+	}
+	return sub.Levels()
+}
+
+// Remove unsubscribes the meter.
+func (m *Meters) Remove(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sub, ok := m.subs[id]; ok {
+		sub.Close()
+		delete(m.subs, id)
+	}
+}
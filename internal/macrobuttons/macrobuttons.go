@@ -0,0 +1,186 @@
+// Package macrobuttons reads the configuration file of the Voicemeeter Macro
+// Buttons app, so keys can show the names and colors given to the buttons
+// there.
+package macrobuttons
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// ButtonCount is the number of macro buttons.
+const ButtonCount = 80
+
+// colorPalette approximates the colors the Macro Buttons app offers, by the
+// index stored in the configuration file. Index 0 is the default color.
+var colorPalette = []string{
+	"",
+	"#b02a2a", // red
+	"#c4661f", // orange
+	"#c9a227", // yellow
+	"#3f9c35", // green
+	"#2a8c8c", // cyan
+	"#2f62b3", // blue
+	"#7a45b0", // purple
+	"#b03f8c", // pink
+}
+
+// Button is a macro button as configured in the Macro Buttons app.
+type Button struct {
+	Index   int
+	Name    string
+	Subname string
+	Color   int
+}
+
+// Label returns the name of the button as shown on the button, with the
+// subname on the next line if there is one.
+func (b *Button) Label() string {
+	if b.Subname == "" {
+		return b.Name
+	}
+	return b.Name + "\n" + b.Subname
+}
+
+// ColorHex returns the color of the button as "#rrggbb", or "" for the
+// default color.
+func (b *Button) ColorHex() string {
+	if b.Color < 0 || b.Color >= len(colorPalette) {
+		return ""
+	}
+	return colorPalette[b.Color]
+}
+
+type xmlButtonMap struct {
+	Buttons []xmlButton `xml:"MacroButton"`
+}
+
+type xmlButton struct {
+	Index   int    `xml:"index,attr"`
+	Color   int    `xml:"color,attr"`
+	Name    string `xml:"MB_Name"`
+	Subname string `xml:"MB_Subname"`
+}
+
+var (
+	cacheMu      sync.Mutex
+	cachePath    string
+	cacheModTime time.Time
+	cacheButtons map[int]Button
+)
+
+// DefaultPath returns where the Macro Buttons app saves its configuration.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		log.Printf("error getting user home dir: %v\n", err)
+		return ""
+	}
+	return filepath.Join(home, "Documents", "Voicemeeter", "MacroButtonConfig.xml")
+}
+
+// Load reads the buttons from the configuration file, keyed by logical ID.
+// An empty path means DefaultPath. The file is only read again when it has
+// changed.
+func Load(path string) (map[int]Button, error) {
+	if path == "" {
+		path = DefaultPath()
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheMu.Lock()
+	defer cacheMu.Unlock()
+	if path == cachePath && info.ModTime().Equal(cacheModTime) {
+		return cacheButtons, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buttons, err := parse(f)
+	if err != nil {
+		log.Printf("error parsing macro buttons config: %v\n", err)
+		return nil, err
+	}
+
+	cachePath = path
+	cacheModTime = info.ModTime()
+	cacheButtons = buttons
+	return buttons, nil
+}
+
+// Get returns a button from the configuration file. A button that is not in
+// the file is returned with an empty name.
+func Get(path string, logicalId int) (Button, error) {
+	if logicalId < 0 || logicalId >= ButtonCount {
+		return Button{}, fmt.Errorf("logicalId %v is out of range", logicalId)
+	}
+	buttons, err := Load(path)
+	if err != nil {
+		return Button{Index: logicalId}, err
+	}
+	b, ok := buttons[logicalId]
+	if !ok {
+		return Button{Index: logicalId}, nil
+	}
+	return b, nil
+}
+
+// charsetReader decodes the legacy encoding a file may declare, such as
+// windows-1252 written by older versions of the Macro Buttons app.
+func charsetReader(charset string, input io.Reader) (io.Reader, error) {
+	var e encoding.Encoding
+	switch strings.ToLower(charset) {
+	case "windows-1252", "cp1252":
+		e = charmap.Windows1252
+	case "iso-8859-1", "latin1":
+		e = charmap.ISO8859_1
+	default:
+		var err error
+		e, err = htmlindex.Get(charset)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported encoding '%v'", charset)
+		}
+	}
+	return e.NewDecoder().Reader(input), nil
+}
+
+func parse(r io.Reader) (map[int]Button, error) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charsetReader
+
+	var m xmlButtonMap
+	if err := d.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	buttons := map[int]Button{}
+	for _, b := range m.Buttons {
+		if b.Index < 0 || b.Index >= ButtonCount {
+			continue
+		}
+		buttons[b.Index] = Button{
+			Index:   b.Index,
+			Name:    strings.TrimSpace(b.Name),
+			Subname: strings.TrimSpace(b.Subname),
+			Color:   b.Color,
+		}
+	}
+	return buttons, nil
+}
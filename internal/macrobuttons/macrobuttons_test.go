@@ -0,0 +1,40 @@
+package macrobuttons
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseEncoding(t *testing.T) {
+	const body = `<MacroButtonConfiguration><MacroButton index="3" color="2"><MB_Name>%s</MB_Name></MacroButton></MacroButtonConfiguration>`
+	tests := []struct {
+		name     string
+		encoding string
+		raw      string // name as written in the file
+		want     string
+	}{
+		{name: "utf-8", encoding: "UTF-8", raw: "Café", want: "Café"},
+		{name: "windows-1252", encoding: "windows-1252", raw: "Caf\xe9 \x80", want: "Café €"},
+		{name: "iso-8859-1", encoding: "ISO-8859-1", raw: "Caf\xe9", want: "Café"},
+		{name: "shift_jis", encoding: "Shift_JIS", raw: "\x83}\x83C\x83N", want: "マイク"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			xml := `<?xml version="1.0" encoding="` + tt.encoding + `"?>` + strings.Replace(body, "%s", tt.raw, 1)
+			buttons, err := parse(strings.NewReader(xml))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := buttons[3].Name; got != tt.want {
+				t.Errorf("Name = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUnknownEncoding(t *testing.T) {
+	xml := `<?xml version="1.0" encoding="x-unknown"?><MacroButtonConfiguration/>`
+	if _, err := parse(strings.NewReader(xml)); err == nil {
+		t.Error("parse() with an unknown encoding error = nil")
+	}
+}
@@ -0,0 +1,209 @@
+// Package recorder drives the built-in recorder of Voicemeeter Banana and
+// Potato and keeps track of its transport state.
+package recorder
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+)
+
+const (
+	OperationPlay   = "play"
+	OperationStop   = "stop"
+	OperationRecord = "record"
+	OperationPause  = "pause"
+	OperationRew    = "rew"
+	OperationFf     = "ff"
+	OperationLoop   = "loop"
+
+	MinGain = -60.0
+	MaxGain = 12.0
+)
+
+// State is the transport state of the recorder.
+type State struct {
+	Playing   bool
+	Recording bool
+	Paused    bool
+	Loop      bool
+}
+
+// Stopped reports whether the recorder is neither playing nor recording.
+func (s State) Stopped() bool {
+	return !s.Playing && !s.Recording
+}
+
+func (s State) String() string {
+	switch {
+	case s.Paused:
+		return "PAUSE"
+	case s.Recording:
+		return "REC"
+	case s.Playing:
+		return "PLAY"
+	default:
+		return "STOP"
+	}
+}
+
+// Available returns an error if the running Voicemeeter kind has no recorder.
+func Available(vm *voicemeeter.Remote) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+	if vm.Recorder == nil {
+		return fmt.Errorf("recorder is not available in Voicemeeter %v", vm.Kind.Name)
+	}
+	return nil
+}
+
+// GetState reads the transport state of the recorder.
+func GetState(vm *voicemeeter.Remote) (State, error) {
+	var s State
+	if err := Available(vm); err != nil {
+		return s, err
+	}
+
+	params := []struct {
+		name string
+		dst  *bool
+	}{
+		{"Recorder.Play", &s.Playing},
+		{"Recorder.Record", &s.Recording},
+		{"Recorder.Pause", &s.Paused},
+		{"Recorder.Mode.Loop", &s.Loop},
+	}
+	for _, param := range params {
+		val, err := vm.GetFloat(param.name)
+		if err != nil {
+			log.Printf("error getting %v: %v\n", param.name, err)
+			return s, err
+		}
+		*param.dst = val != 0
+	}
+	return s, nil
+}
+
+// Do performs a transport operation. OperationLoop toggles loop mode.
+func Do(vm *voicemeeter.Remote, operation string) error {
+	if err := Available(vm); err != nil {
+		return err
+	}
+
+	r := vm.Recorder
+	switch operation {
+	case OperationPlay:
+		r.Play()
+	case OperationStop:
+		// The transport buttons are triggered by writing 1, but the
+		// library's Stop writes 0, so set the parameter directly.
+		if err := vm.SetFloat("Recorder.Stop", 1); err != nil {
+			log.Printf("error stopping recorder: %v\n", err)
+			return err
+		}
+	case OperationRecord:
+		r.Record()
+	case OperationPause:
+		r.Pause()
+	case OperationRew:
+		r.Rew()
+	case OperationFf:
+		r.Ff()
+	case OperationLoop:
+		s, err := GetState(vm)
+		if err != nil {
+			return err
+		}
+		r.Loop(!s.Loop)
+	default:
+		return fmt.Errorf("unknown operation: '%v'", operation)
+	}
+	return nil
+}
+
+// GetGain returns the recorder gain in dB.
+func GetGain(vm *voicemeeter.Remote) (float64, error) {
+	if err := Available(vm); err != nil {
+		return 0, err
+	}
+	return vm.Recorder.Gain(), nil
+}
+
+// AdjustGain changes the recorder gain by delta dB and returns the new gain.
+func AdjustGain(vm *voicemeeter.Remote, delta float64) (float64, error) {
+	gain, err := GetGain(vm)
+	if err != nil {
+		return 0, err
+	}
+	gain += delta
+	if gain > MaxGain {
+		gain = MaxGain
+	}
+	if gain < MinGain {
+		gain = MinGain
+	}
+	vm.Recorder.SetGain(gain)
+	return gain, nil
+}
+
+// Clock measures how long the recorder has been playing or recording.
+// Voicemeeter does not expose the position of the recorder, so the time is
+// counted locally from the observed transport state: it runs while playing
+// or recording, holds while paused, and resets when stopped or when the
+// recorder switches between playing and recording.
+type Clock struct {
+	mu        sync.Mutex
+	running   bool
+	recording bool
+	started   time.Time
+	elapsed   time.Duration
+}
+
+// Update feeds the current state to the clock and returns the elapsed time.
+func (c *Clock) Update(s State, now time.Time) time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if s.Stopped() && !s.Paused {
+		c.running = false
+		c.elapsed = 0
+		return 0
+	}
+
+	if s.Recording != c.recording {
+		c.recording = s.Recording
+		c.running = false
+		c.elapsed = 0
+	}
+
+	switch {
+	case s.Paused && c.running:
+		c.elapsed += now.Sub(c.started)
+		c.running = false
+	case !s.Paused && !c.running:
+		c.started = now
+		c.running = true
+	}
+
+	if c.running {
+		return c.elapsed + now.Sub(c.started)
+	}
+	return c.elapsed
+}
+
+// FormatDuration formats d as H:MM:SS, or MM:SS below one hour.
+func FormatDuration(d time.Duration) string {
+	sec := int(d / time.Second)
+	h := sec / 3600
+	m := sec / 60 % 60
+	s := sec % 60
+	if h > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", h, m, s)
+	}
+	return fmt.Sprintf("%02d:%02d", m, s)
+}
@@ -0,0 +1,34 @@
+// Package resync lets actions ask every other action to re-read the
+// Voicemeeter state, e.g. after the audio engine has been restarted.
+package resync
+
+import (
+	"sync"
+)
+
+var (
+	mu          sync.Mutex
+	subscribers []chan struct{}
+)
+
+// Subscribe returns a channel that receives a value on every Broadcast.
+// Broadcasts are coalesced while the subscriber is busy.
+func Subscribe() <-chan struct{} {
+	ch := make(chan struct{}, 1)
+	mu.Lock()
+	subscribers = append(subscribers, ch)
+	mu.Unlock()
+	return ch
+}
+
+// Broadcast notifies all subscribers without blocking.
+func Broadcast() {
+	mu.Lock()
+	defer mu.Unlock()
+	for _, ch := range subscribers {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+}
@@ -0,0 +1,176 @@
+// Package scene captures and recalls mixer snapshots of selected strips and
+// buses, and keeps them in a JSON file in the plugin data directory.
+package scene
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
+)
+
+type Scene struct {
+	Name       string          `json:"name"`
+	VmKind     string          `json:"vmKind"`
+	CapturedAt time.Time       `json:"capturedAt"`
+	Strips     []StripSnapshot `json:"strips"`
+	Buses      []BusSnapshot   `json:"buses"`
+}
+
+type StripSnapshot struct {
+	Index   int             `json:"index"`
+	Gain    float64         `json:"gain"`
+	Routing []string        `json:"routing"`
+	Flags   map[string]bool `json:"flags"` // key: stripbus.Flag*
+}
+
+type BusSnapshot struct {
+	Index int             `json:"index"`
+	Gain  float64         `json:"gain"`
+	Flags map[string]bool `json:"flags"` // key: stripbus.Flag*
+}
+
+// Capture reads the state of the given strips and buses. Indexes out of
+// range for the running Voicemeeter kind are skipped.
+func Capture(vm *voicemeeter.Remote, name string, stripIndexes, busIndexes []int) (*Scene, error) {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return nil, fmt.Errorf("vm is nil")
+	}
+
+	s := &Scene{
+		Name:       name,
+		VmKind:     vm.Kind.Name,
+		CapturedAt: time.Now(),
+		Strips:     []StripSnapshot{},
+		Buses:      []BusSnapshot{},
+	}
+
+	for _, index := range stripIndexes {
+		if index < 0 || index >= len(vm.Strip) {
+			log.Printf("skipping strip %v: out of range\n", index)
+			continue
+		}
+		gain, err := stripbus.GetGain(vm, "Strip", index)
+		if err != nil {
+			return nil, err
+		}
+		routing, err := stripbus.GetStripRouting(vm, index)
+		if err != nil {
+			return nil, err
+		}
+		flags, err := captureFlags(vm, "Strip", index)
+		if err != nil {
+			return nil, err
+		}
+		s.Strips = append(s.Strips, StripSnapshot{
+			Index:   index,
+			Gain:    gain,
+			Routing: routing,
+			Flags:   flags,
+		})
+	}
+
+	for _, index := range busIndexes {
+		if index < 0 || index >= len(vm.Bus) {
+			log.Printf("skipping bus %v: out of range\n", index)
+			continue
+		}
+		gain, err := stripbus.GetGain(vm, "Bus", index)
+		if err != nil {
+			return nil, err
+		}
+		flags, err := captureFlags(vm, "Bus", index)
+		if err != nil {
+			return nil, err
+		}
+		s.Buses = append(s.Buses, BusSnapshot{
+			Index: index,
+			Gain:  gain,
+			Flags: flags,
+		})
+	}
+
+	return s, nil
+}
+
+func captureFlags(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) (map[string]bool, error) {
+	status, err := stripbus.GetStripOrBusStatus(vm, stripOrBusKind, stripOrBusIndex)
+	if err != nil {
+		return nil, err
+	}
+	flags := map[string]bool{}
+	for _, flag := range stripbus.SupportedFlagsOf(vm, stripOrBusKind, stripOrBusIndex) {
+		on, err := status.Flag(flag)
+		if err != nil {
+			return nil, err
+		}
+		flags[flag] = on
+	}
+	return flags, nil
+}
+
+// Apply recalls the scene. Gains are crossfaded over fade when it is
+// positive; everything else is switched at once. Entries that do not exist
+// in the running Voicemeeter kind are skipped, so a scene captured on a
+// larger edition can still be recalled partially.
+func (s *Scene) Apply(vm *voicemeeter.Remote, fade time.Duration) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+
+	for _, strip := range s.Strips {
+		if strip.Index < 0 || strip.Index >= len(vm.Strip) {
+			log.Printf("skipping strip %v: out of range\n", strip.Index)
+			continue
+		}
+		if err := stripbus.SetStripRouting(vm, strip.Index, strip.Routing); err != nil {
+			return err
+		}
+		if err := applyFlags(vm, "Strip", strip.Index, strip.Flags); err != nil {
+			return err
+		}
+		if err := applyGain(vm, "Strip", strip.Index, strip.Gain, fade); err != nil {
+			return err
+		}
+	}
+
+	for _, bus := range s.Buses {
+		if bus.Index < 0 || bus.Index >= len(vm.Bus) {
+			log.Printf("skipping bus %v: out of range\n", bus.Index)
+			continue
+		}
+		if err := applyFlags(vm, "Bus", bus.Index, bus.Flags); err != nil {
+			return err
+		}
+		if err := applyGain(vm, "Bus", bus.Index, bus.Gain, fade); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func applyFlags(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int, flags map[string]bool) error {
+	for _, flag := range stripbus.SupportedFlagsOf(vm, stripOrBusKind, stripOrBusIndex) {
+		on, ok := flags[flag]
+		if !ok {
+			continue
+		}
+		if err := stripbus.SetFlag(vm, stripOrBusKind, stripOrBusIndex, flag, on); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applyGain(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int, gain float64, fade time.Duration) error {
+	if fade > 0 {
+		return stripbus.FadeGain(vm, stripOrBusKind, stripOrBusIndex, gain, fade)
+	}
+	return stripbus.SetGain(vm, stripOrBusKind, stripOrBusIndex, gain)
+}
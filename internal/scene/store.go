@@ -0,0 +1,120 @@
+package scene
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const storeFileName = "scenes.json"
+
+var (
+	storeDir string
+	storeMu  sync.Mutex
+)
+
+// SetStoreDir sets the directory where scenes are saved.
+// If not set, the user config directory is used.
+func SetStoreDir(dir string) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+	storeDir = dir
+}
+
+func storePath() string {
+	dir := storeDir
+	if dir == "" {
+		userConfigDir, err := os.UserConfigDir()
+		if err != nil {
+			userConfigDir = os.TempDir()
+		}
+		dir = filepath.Join(userConfigDir, "streamdeck-voicemeeter")
+	}
+	return filepath.Join(dir, storeFileName)
+}
+
+// load must be called with storeMu held.
+func load() (map[string]*Scene, error) {
+	scenes := map[string]*Scene{}
+	b, err := os.ReadFile(storePath())
+	if errors.Is(err, os.ErrNotExist) {
+		return scenes, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &scenes); err != nil {
+		return nil, err
+	}
+	return scenes, nil
+}
+
+// save must be called with storeMu held. The file is replaced atomically so
+// that a crash never leaves a truncated store behind.
+func save(scenes map[string]*Scene) error {
+	path := storePath()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(scenes, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), storeFileName+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Get returns the scene saved under the name.
+func Get(name string) (*Scene, error) {
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	scenes, err := load()
+	if err != nil {
+		log.Printf("error loading scenes: %v\n", err)
+		return nil, err
+	}
+	s, ok := scenes[name]
+	if !ok {
+		return nil, fmt.Errorf("scene '%v' not found", name)
+	}
+	return s, nil
+}
+
+// Put saves the scene under its name, replacing an existing one.
+func Put(s *Scene) error {
+	if s.Name == "" {
+		return fmt.Errorf("scene name is empty")
+	}
+
+	storeMu.Lock()
+	defer storeMu.Unlock()
+
+	scenes, err := load()
+	if err != nil {
+		log.Printf("error loading scenes: %v\n", err)
+		return err
+	}
+	scenes[s.Name] = s
+	if err := save(scenes); err != nil {
+		log.Printf("error saving scenes: %v\n", err)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,144 @@
+// Package sequence parses timed lists of steps, such as "mute the mic, wait
+// 500 ms, fade the music down over 2 s, press macro button 12". Package
+// sequencer runs them.
+//
+// A sequence is written one step per line:
+//
+//	set Strip[0].Mute=1
+//	wait 500ms
+//	fade Bus[1] -20 2s
+//	press 12
+//
+// Empty lines and lines starting with '#' are ignored. A duration without
+// a unit is in milliseconds.
+package sequence
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	StepSet   = "set"
+	StepPress = "press"
+	StepFade  = "fade"
+	StepWait  = "wait"
+)
+
+var targetPattern = regexp.MustCompile(`^(?i)(strip|bus)(?:\[(\d+)\]|\((\d+)\))$`)
+
+type Step struct {
+	Kind            string // "set" | "press" | "fade" | "wait"
+	Script          string // set
+	LogicalId       int    // press
+	StripOrBusKind  string // fade; "Strip" | "Bus"
+	StripOrBusIndex int    // fade
+	Gain            float64
+	Duration        time.Duration // fade, wait
+}
+
+func (s *Step) String() string {
+	switch s.Kind {
+	case StepSet:
+		return fmt.Sprintf("set %v", s.Script)
+	case StepPress:
+		return fmt.Sprintf("press %v", s.LogicalId)
+	case StepFade:
+		return fmt.Sprintf("fade %v[%v] %v %v", s.StripOrBusKind, s.StripOrBusIndex, s.Gain, s.Duration)
+	case StepWait:
+		return fmt.Sprintf("wait %v", s.Duration)
+	default:
+		return s.Kind
+	}
+}
+
+// Parse parses a sequence, one step per line.
+func Parse(text string) ([]Step, error) {
+	steps := []Step{}
+	for i, line := range strings.Split(text, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		step, err := parseStep(line)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		steps = append(steps, step)
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("sequence is empty")
+	}
+	return steps, nil
+}
+
+func parseStep(line string) (Step, error) {
+	command, rest, _ := strings.Cut(line, " ")
+	rest = strings.TrimSpace(rest)
+	fields := strings.Fields(rest)
+
+	switch strings.ToLower(command) {
+	case StepSet:
+		if rest == "" {
+			return Step{}, fmt.Errorf("set needs a script")
+		}
+		return Step{Kind: StepSet, Script: rest}, nil
+
+	case StepPress:
+		if len(fields) != 1 {
+			return Step{}, fmt.Errorf("press needs a macro button id")
+		}
+		logicalId, err := strconv.Atoi(fields[0])
+		if err != nil {
+			return Step{}, fmt.Errorf("invalid macro button id '%v'", fields[0])
+		}
+		return Step{Kind: StepPress, LogicalId: logicalId}, nil
+
+	case StepFade:
+		if len(fields) < 3 {
+			return Step{}, fmt.Errorf("fade needs a strip or bus, a gain and a duration")
+		}
+		m := targetPattern.FindStringSubmatch(fields[0])
+		if m == nil {
+			return Step{}, fmt.Errorf("invalid strip or bus '%v'", fields[0])
+		}
+		index, _ := strconv.Atoi(m[2] + m[3])
+		gain, err := strconv.ParseFloat(strings.TrimSuffix(strings.ToLower(fields[1]), "db"), 64)
+		if err != nil {
+			return Step{}, fmt.Errorf("invalid gain '%v'", fields[1])
+		}
+		duration, err := parseDuration(strings.Join(fields[2:], ""))
+		if err != nil {
+			return Step{}, err
+		}
+		kind := "Strip"
+		if strings.EqualFold(m[1], "bus") {
+			kind = "Bus"
+		}
+		return Step{Kind: StepFade, StripOrBusKind: kind, StripOrBusIndex: index, Gain: gain, Duration: duration}, nil
+
+	case StepWait:
+		duration, err := parseDuration(strings.Join(fields, ""))
+		if err != nil {
+			return Step{}, err
+		}
+		return Step{Kind: StepWait, Duration: duration}, nil
+
+	default:
+		return Step{}, fmt.Errorf("unknown step '%v'", command)
+	}
+}
+
+func parseDuration(s string) (time.Duration, error) {
+	if ms, err := strconv.Atoi(s); err == nil {
+		s = fmt.Sprintf("%dms", ms)
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration '%v'", s)
+	}
+	return d, nil
+}
@@ -0,0 +1,91 @@
+package sequence
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		text    string
+		want    []Step
+		wantErr bool
+	}{
+		{
+			name: "every kind",
+			text: "set Strip[0].Mute=1\nwait 500ms\nfade Bus[1] -20 2s\npress 12",
+			want: []Step{
+				{Kind: StepSet, Script: "Strip[0].Mute=1"},
+				{Kind: StepWait, Duration: 500 * time.Millisecond},
+				{Kind: StepFade, StripOrBusKind: "Bus", StripOrBusIndex: 1, Gain: -20, Duration: 2 * time.Second},
+				{Kind: StepPress, LogicalId: 12},
+			},
+		},
+		{
+			name: "comments, blank lines and case",
+			text: "# duck the music\n\n  SET Strip[1].Gain=-10 ; Strip[2].Mute=0  \r\nFade strip(3) -6dB 1 s\n",
+			want: []Step{
+				{Kind: StepSet, Script: "Strip[1].Gain=-10 ; Strip[2].Mute=0"},
+				{Kind: StepFade, StripOrBusKind: "Strip", StripOrBusIndex: 3, Gain: -6, Duration: time.Second},
+			},
+		},
+		{name: "empty", text: "\n# nothing\n", wantErr: true},
+		{name: "unknown step", text: "jump 1", wantErr: true},
+		{name: "set without script", text: "set", wantErr: true},
+		{name: "press without id", text: "press", wantErr: true},
+		{name: "press with bad id", text: "press one", wantErr: true},
+		{name: "fade without duration", text: "fade Bus[1] -20", wantErr: true},
+		{name: "fade with bad target", text: "fade Bus -20 1s", wantErr: true},
+		{name: "fade with bad gain", text: "fade Bus[0] loud 1s", wantErr: true},
+		{name: "wait with bad duration", text: "wait soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.text)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Parse() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseLineNumber(t *testing.T) {
+	_, err := Parse("wait 1s\n\njump 1")
+	if err == nil || err.Error() != "line 3: unknown step 'jump'" {
+		t.Errorf("Parse() error = %v, want the line of the bad step", err)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    time.Duration
+		wantErr bool
+	}{
+		{s: "250", want: 250 * time.Millisecond},
+		{s: "0", want: 0},
+		{s: "500ms", want: 500 * time.Millisecond},
+		{s: "1.5s", want: 1500 * time.Millisecond},
+		{s: "1m", want: time.Minute},
+		{s: "-1s", wantErr: true},
+		{s: "-5", wantErr: true},
+		{s: "", wantErr: true},
+		{s: "soon", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := parseDuration(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseDuration(%q) error = %v, wantErr %v", tt.s, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseDuration(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
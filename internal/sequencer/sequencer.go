@@ -0,0 +1,186 @@
+// Package sequencer runs the steps of a sequence on Voicemeeter, and undoes
+// them.
+package sequencer
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/sequence"
+	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmscript"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmsyntax"
+)
+
+const progressInterval = time.Second / 15
+
+// Validate checks the steps against the edition vm is logged in to.
+func Validate(vm *voicemeeter.Remote, steps []sequence.Step) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+
+	for i, step := range steps {
+		var err error
+		switch step.Kind {
+		case sequence.StepSet:
+			err = vmscript.Validate(vm, step.Script)
+		case sequence.StepPress:
+			if step.LogicalId < 0 || step.LogicalId >= len(vm.Button) {
+				err = fmt.Errorf("macro button id %v is out of range", step.LogicalId)
+			}
+		case sequence.StepFade:
+			_, err = stripbus.GetGain(vm, step.StripOrBusKind, step.StripOrBusIndex)
+		}
+		if err != nil {
+			return fmt.Errorf("step %d '%v': %w", i+1, step.String(), err)
+		}
+	}
+	return nil
+}
+
+// Run runs the steps in order until they finish or ctx is canceled, calling
+// progress with the fraction done so far (0 to 1). Waits and fades count by
+// their duration; if there are none, every step counts the same.
+//
+// Run returns the steps that undo what it has done, in the order to run
+// them: waits are kept, fades go back to the previous gain, and parameters
+// and macro buttons are set back to their previous values.
+func Run(ctx context.Context, vm *voicemeeter.Remote, steps []sequence.Step, progress func(fraction float64)) ([]sequence.Step, error) {
+	var total time.Duration
+	for _, step := range steps {
+		total += step.Duration
+	}
+	var elapsed time.Duration
+	report := func(done int, stepElapsed time.Duration) {
+		if progress == nil {
+			return
+		}
+		if total == 0 {
+			progress(float64(done) / float64(len(steps)))
+			return
+		}
+		progress(float64(elapsed+stepElapsed) / float64(total))
+	}
+
+	undo := []sequence.Step{}
+	for i, step := range steps {
+		if err := ctx.Err(); err != nil {
+			return undo, err
+		}
+
+		inverse, err := runStep(vm, step)
+		if err != nil {
+			log.Printf("error running step '%v': %v\n", step.String(), err)
+			return undo, err
+		}
+		undo = append(inverse, undo...)
+
+		if step.Duration > 0 {
+			err := sleep(ctx, step.Duration, func(d time.Duration) { report(i, d) })
+			if err != nil {
+				return undo, err
+			}
+			elapsed += step.Duration
+		}
+		report(i+1, 0)
+	}
+	return undo, nil
+}
+
+// runStep runs a step that does not wait, and returns its inverse.
+func runStep(vm *voicemeeter.Remote, step sequence.Step) ([]sequence.Step, error) {
+	switch step.Kind {
+	case sequence.StepSet:
+		inverse := undoScript(vm, step.Script)
+		if err := vmscript.Run(vm, step.Script); err != nil {
+			return nil, err
+		}
+		if inverse == "" {
+			return nil, nil
+		}
+		return []sequence.Step{{Kind: sequence.StepSet, Script: inverse}}, nil
+
+	case sequence.StepPress:
+		if step.LogicalId < 0 || step.LogicalId >= len(vm.Button) {
+			return nil, fmt.Errorf("macro button id %v is out of range", step.LogicalId)
+		}
+		button := vm.Button[step.LogicalId]
+		state := button.State()
+		button.SetState(!state)
+		return []sequence.Step{{Kind: sequence.StepPress, LogicalId: step.LogicalId}}, nil
+
+	case sequence.StepFade:
+		gain, err := stripbus.GetGain(vm, step.StripOrBusKind, step.StripOrBusIndex)
+		if err != nil {
+			return nil, err
+		}
+		if err := stripbus.FadeGain(vm, step.StripOrBusKind, step.StripOrBusIndex, step.Gain, step.Duration); err != nil {
+			return nil, err
+		}
+		inverse := step
+		inverse.Gain = gain
+		return []sequence.Step{inverse}, nil
+
+	case sequence.StepWait:
+		return []sequence.Step{step}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown step '%v'", step.Kind)
+	}
+}
+
+// undoScript returns a script that sets the parameters of script back to
+// their current values, so it must be called before script runs. Parameters
+// that cannot be read are left out.
+func undoScript(vm *voicemeeter.Remote, script string) string {
+	statements := []string{}
+	for _, statement := range vmsyntax.Split(script) {
+		a, err := vmsyntax.ParseStatement(statement)
+		if err != nil {
+			continue
+		}
+		if a.IsString() {
+			value, err := vm.GetString(a.Name)
+			if err != nil {
+				log.Printf("error getting '%v': %v\n", a.Name, err)
+				continue
+			}
+			// Voicemeeter strings have no escapes, so the value is quoted as is
+			statements = append(statements, a.Name+`="`+value+`"`)
+		} else {
+			value, err := vm.GetFloat(a.Name)
+			if err != nil {
+				log.Printf("error getting '%v': %v\n", a.Name, err)
+				continue
+			}
+			statements = append(statements, fmt.Sprintf("%v=%v", a.Name, strconv.FormatFloat(value, 'f', -1, 64)))
+		}
+	}
+	return strings.Join(statements, ";")
+}
+
+func sleep(ctx context.Context, d time.Duration, tick func(elapsed time.Duration)) error {
+	start := time.Now()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+			return nil
+		case <-ticker.C:
+			tick(time.Since(start))
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package stripbus
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+)
+
+func GetMute(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) (bool, error) {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return false, fmt.Errorf("vm is nil")
+	}
+
+	switch stripOrBusKind {
+	case "Strip":
+		if stripOrBusIndex >= len(vm.Strip) || stripOrBusIndex < 0 {
+			log.Printf("stripIndex %v is out of range\n", stripOrBusIndex)
+			return false, fmt.Errorf("stripIndex %v is out of range", stripOrBusIndex)
+		}
+		return vm.Strip[stripOrBusIndex].Mute(), nil
+
+	case "Bus":
+		if stripOrBusIndex >= len(vm.Bus) || stripOrBusIndex < 0 {
+			log.Printf("busIndex %v is out of range\n", stripOrBusIndex)
+			return false, fmt.Errorf("busIndex %v is out of range", stripOrBusIndex)
+		}
+		return vm.Bus[stripOrBusIndex].Mute(), nil
+
+	default:
+		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		return false, fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind)
+	}
+}
+
+func SetMute(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int, mute bool) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+
+	switch stripOrBusKind {
+	case "Strip":
+		if stripOrBusIndex >= len(vm.Strip) || stripOrBusIndex < 0 {
+			log.Printf("stripIndex %v is out of range\n", stripOrBusIndex)
+			return fmt.Errorf("stripIndex %v is out of range", stripOrBusIndex)
+		}
+		vm.Strip[stripOrBusIndex].SetMute(mute)
+
+	case "Bus":
+		if stripOrBusIndex >= len(vm.Bus) || stripOrBusIndex < 0 {
+			log.Printf("busIndex %v is out of range\n", stripOrBusIndex)
+			return fmt.Errorf("busIndex %v is out of range", stripOrBusIndex)
+		}
+		vm.Bus[stripOrBusIndex].SetMute(mute)
+
+	default:
+		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		return fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind)
+	}
+
+	return nil
+}
+
+// ToggleMute flips the mute state and returns the new state.
+func ToggleMute(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) (bool, error) {
+	mute, err := GetMute(vm, stripOrBusKind, stripOrBusIndex)
+	if err != nil {
+		return false, err
+	}
+	if err := SetMute(vm, stripOrBusKind, stripOrBusIndex, !mute); err != nil {
+		return false, err
+	}
+	return !mute, nil
+}
+
+const (
+	GainMin = -60.0
+	GainMax = 12.0
+)
+
+func GetGain(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) (float64, error) {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return 0, fmt.Errorf("vm is nil")
+	}
+
+	switch stripOrBusKind {
+	case "Strip":
+		if stripOrBusIndex >= len(vm.Strip) || stripOrBusIndex < 0 {
+			log.Printf("stripIndex %v is out of range\n", stripOrBusIndex)
+			return 0, fmt.Errorf("stripIndex %v is out of range", stripOrBusIndex)
+		}
+		return vm.Strip[stripOrBusIndex].Gain(), nil
+
+	case "Bus":
+		if stripOrBusIndex >= len(vm.Bus) || stripOrBusIndex < 0 {
+			log.Printf("busIndex %v is out of range\n", stripOrBusIndex)
+			return 0, fmt.Errorf("busIndex %v is out of range", stripOrBusIndex)
+		}
+		return vm.Bus[stripOrBusIndex].Gain(), nil
+
+	default:
+		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		return 0, fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind)
+	}
+}
+
+// SetGain sets the gain clamped to the range of the Voicemeeter fader.
+func SetGain(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int, gain float64) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+
+	gain = max(GainMin, min(GainMax, gain))
+
+	switch stripOrBusKind {
+	case "Strip":
+		if stripOrBusIndex >= len(vm.Strip) || stripOrBusIndex < 0 {
+			log.Printf("stripIndex %v is out of range\n", stripOrBusIndex)
+			return fmt.Errorf("stripIndex %v is out of range", stripOrBusIndex)
+		}
+		vm.Strip[stripOrBusIndex].SetGain(gain)
+
+	case "Bus":
+		if stripOrBusIndex >= len(vm.Bus) || stripOrBusIndex < 0 {
+			log.Printf("busIndex %v is out of range\n", stripOrBusIndex)
+			return fmt.Errorf("busIndex %v is out of range", stripOrBusIndex)
+		}
+		vm.Bus[stripOrBusIndex].SetGain(gain)
+
+	default:
+		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		return fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind)
+	}
+
+	return nil
+}
+
+// Gains reads and sets the gains of the strips and buses of VM, for code that
+// does not depend on Voicemeeter itself.
+type Gains struct {
+	VM *voicemeeter.Remote
+}
+
+func (g Gains) GetGain(stripOrBusKind string, stripOrBusIndex int) (float64, error) {
+	return GetGain(g.VM, stripOrBusKind, stripOrBusIndex)
+}
+
+// SetGain sets the gain clamped to the range of the Voicemeeter fader, and
+// returns the gain set.
+func (g Gains) SetGain(stripOrBusKind string, stripOrBusIndex int, gain float64) (float64, error) {
+	gain = max(GainMin, min(GainMax, gain))
+	return gain, SetGain(g.VM, stripOrBusKind, stripOrBusIndex, gain)
+}
+
+// AdjustGain adds delta to the current gain and returns the new gain.
+func AdjustGain(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int, delta float64) (float64, error) {
+	gain, err := GetGain(vm, stripOrBusKind, stripOrBusIndex)
+	if err != nil {
+		return 0, err
+	}
+	gain = max(GainMin, min(GainMax, gain+delta))
+	if err := SetGain(vm, stripOrBusKind, stripOrBusIndex, gain); err != nil {
+		return 0, err
+	}
+	return gain, nil
+}
+
+// FadeGain lets Voicemeeter move the gain to the target over the duration.
+// It returns without waiting for the fade to finish.
+func FadeGain(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int, gain float64, duration time.Duration) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+
+	gain = max(GainMin, min(GainMax, gain))
+	ms := int(duration.Milliseconds())
+
+	switch stripOrBusKind {
+	case "Strip":
+		if stripOrBusIndex >= len(vm.Strip) || stripOrBusIndex < 0 {
+			log.Printf("stripIndex %v is out of range\n", stripOrBusIndex)
+			return fmt.Errorf("stripIndex %v is out of range", stripOrBusIndex)
+		}
+		vm.Strip[stripOrBusIndex].FadeTo(gain, ms)
+
+	case "Bus":
+		if stripOrBusIndex >= len(vm.Bus) || stripOrBusIndex < 0 {
+			log.Printf("busIndex %v is out of range\n", stripOrBusIndex)
+			return fmt.Errorf("busIndex %v is out of range", stripOrBusIndex)
+		}
+		vm.Bus[stripOrBusIndex].FadeTo(float32(gain), ms)
+
+	default:
+		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		return fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind)
+	}
+
+	return nil
+}
+
+// GetLevels returns the levels of the first two channels in dB.
+// Strips are read post-fader, buses as they are output.
+func GetLevels(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) ([]float64, error) {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return nil, fmt.Errorf("vm is nil")
+	}
+
+	switch stripOrBusKind {
+	case "Strip":
+		if stripOrBusIndex >= len(vm.Strip) || stripOrBusIndex < 0 {
+			log.Printf("stripIndex %v is out of range\n", stripOrBusIndex)
+			return nil, fmt.Errorf("stripIndex %v is out of range", stripOrBusIndex)
+		}
+		levels := vm.Strip[stripOrBusIndex].Levels().PostFader()
+		return levels[:2], nil
+
+	case "Bus":
+		if stripOrBusIndex >= len(vm.Bus) || stripOrBusIndex < 0 {
+			log.Printf("busIndex %v is out of range\n", stripOrBusIndex)
+			return nil, fmt.Errorf("busIndex %v is out of range", stripOrBusIndex)
+		}
+		levels := vm.Bus[stripOrBusIndex].Levels().All()
+		return levels[:2], nil
+
+	default:
+		log.Printf("unknown stripOrBusKind: '%v'\n", stripOrBusKind)
+		return nil, fmt.Errorf("unknown stripOrBusKind: '%v'", stripOrBusKind)
+	}
+}
@@ -0,0 +1,206 @@
+package stripbus
+
+import (
+	"fmt"
+	"log"
+	"slices"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+)
+
+const (
+	FlagMute    = "mute"
+	FlagSolo    = "solo"
+	FlagMono    = "mono"
+	FlagEq      = "eq"
+	FlagMc      = "mc"
+	FlagKaraoke = "karaoke"
+)
+
+// SupportedFlags returns the boolean flags available for the strip or bus
+// in the given Voicemeeter kind. It follows what GetStripStatus and
+// GetBusStatus collect.
+func SupportedFlags(vmKind string, stripOrBusKind string, isPhysical bool) []string {
+	switch stripOrBusKind {
+	case "Strip":
+		switch vmKind {
+		case "basic":
+			if isPhysical {
+				return []string{FlagMute, FlagSolo, FlagMono}
+			}
+			return []string{FlagMute, FlagSolo}
+		case "banana":
+			if isPhysical {
+				return []string{FlagMute, FlagSolo, FlagMono}
+			}
+			return []string{FlagMute, FlagSolo, FlagMc, FlagKaraoke}
+		case "potato":
+			if isPhysical {
+				return []string{FlagMute, FlagSolo, FlagMono, FlagEq}
+			}
+			return []string{FlagMute, FlagSolo, FlagMc, FlagKaraoke}
+		}
+
+	case "Bus":
+		switch vmKind {
+		case "basic":
+			return []string{FlagMute}
+		case "banana", "potato":
+			return []string{FlagMute, FlagEq, FlagMono}
+		}
+	}
+
+	return []string{}
+}
+
+// SupportedFlagsOf returns SupportedFlags for the strip or bus of the
+// running Voicemeeter.
+func SupportedFlagsOf(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int) []string {
+	isPhysical := false
+	switch stripOrBusKind {
+	case "Strip":
+		isPhysical = stripOrBusIndex < vm.Kind.PhysIn
+	case "Bus":
+		isPhysical = stripOrBusIndex < vm.Kind.PhysOut
+	}
+	return SupportedFlags(vm.Kind.Name, stripOrBusKind, isPhysical)
+}
+
+func (ss *StripStatus) Flag(flag string) (bool, error) {
+	if !slices.Contains(SupportedFlags(ss.VmKind, "Strip", ss.IsPhysical), flag) {
+		return false, fmt.Errorf("unsupported flag: '%v'", flag)
+	}
+
+	switch flag {
+	case FlagMute:
+		return ss.Mute, nil
+	case FlagSolo:
+		return ss.Solo, nil
+	case FlagMono:
+		return ss.Mono, nil
+	case FlagEq:
+		return ss.Eq, nil
+	case FlagMc:
+		return ss.Mc, nil
+	case FlagKaraoke:
+		return ss.Karaoke, nil
+	}
+	return false, nil
+}
+
+func (bs *BusStatus) Flag(flag string) (bool, error) {
+	if !slices.Contains(SupportedFlags(bs.VmKind, "Bus", false), flag) {
+		return false, fmt.Errorf("unsupported flag: '%v'", flag)
+	}
+
+	switch flag {
+	case FlagMute:
+		return bs.Mute, nil
+	case FlagEq:
+		return bs.Eq, nil
+	case FlagMono:
+		return bs.Mono, nil
+	}
+	return false, nil
+}
+
+func GetFlag(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int, flag string) (bool, error) {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return false, fmt.Errorf("vm is nil")
+	}
+
+	status, err := GetStripOrBusStatus(vm, stripOrBusKind, stripOrBusIndex)
+	if err != nil {
+		return false, err
+	}
+	return status.Flag(flag)
+}
+
+func SetFlag(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int, flag string, on bool) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+
+	if !slices.Contains(SupportedFlagsOf(vm, stripOrBusKind, stripOrBusIndex), flag) {
+		log.Printf("unsupported flag: '%v'\n", flag)
+		return fmt.Errorf("unsupported flag: '%v'", flag)
+	}
+
+	switch stripOrBusKind {
+	case "Strip":
+		if stripOrBusIndex >= len(vm.Strip) || stripOrBusIndex < 0 {
+			log.Printf("stripIndex %v is out of range\n", stripOrBusIndex)
+			return fmt.Errorf("stripIndex %v is out of range", stripOrBusIndex)
+		}
+		strip := vm.Strip[stripOrBusIndex]
+		switch flag {
+		case FlagMute:
+			strip.SetMute(on)
+		case FlagSolo:
+			strip.SetSolo(on)
+		case FlagMono:
+			strip.SetMono(on)
+		case FlagEq:
+			strip.Eq().SetOn(on)
+		case FlagMc:
+			strip.SetMc(on)
+		case FlagKaraoke:
+			return setKaraoke(vm, stripOrBusIndex, on)
+		}
+
+	case "Bus":
+		if stripOrBusIndex >= len(vm.Bus) || stripOrBusIndex < 0 {
+			log.Printf("busIndex %v is out of range\n", stripOrBusIndex)
+			return fmt.Errorf("busIndex %v is out of range", stripOrBusIndex)
+		}
+		bus := vm.Bus[stripOrBusIndex]
+		switch flag {
+		case FlagMute:
+			bus.SetMute(on)
+		case FlagEq:
+			bus.Eq().SetOn(on)
+		case FlagMono:
+			bus.SetMono(on)
+		}
+	}
+
+	return nil
+}
+
+// ToggleFlag flips the flag and returns the new state.
+func ToggleFlag(vm *voicemeeter.Remote, stripOrBusKind string, stripOrBusIndex int, flag string) (bool, error) {
+	on, err := GetFlag(vm, stripOrBusKind, stripOrBusIndex, flag)
+	if err != nil {
+		return false, err
+	}
+	if err := SetFlag(vm, stripOrBusKind, stripOrBusIndex, flag, !on); err != nil {
+		return false, err
+	}
+	return !on, nil
+}
+
+// Karaoke is not wrapped by the voicemeeter package. It takes a mode from 0
+// to 4; any mode other than 0 is reported as on, and turning it on selects
+// mode 1.
+func getKaraoke(vm *voicemeeter.Remote, stripIndex int) bool {
+	val, err := vm.GetFloat(fmt.Sprintf("Strip[%d].Karaoke", stripIndex))
+	if err != nil {
+		log.Printf("error getting karaoke: %v\n", err)
+		return false
+	}
+	return val != 0
+}
+
+func setKaraoke(vm *voicemeeter.Remote, stripIndex int, on bool) error {
+	val := 0.0
+	if on {
+		val = 1.0
+	}
+	if err := vm.SetFloat(fmt.Sprintf("Strip[%d].Karaoke", stripIndex), val); err != nil {
+		log.Printf("error setting karaoke: %v\n", err)
+		return err
+	}
+	return nil
+}
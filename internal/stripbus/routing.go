@@ -0,0 +1,161 @@
+package stripbus
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+)
+
+// OutputBuses returns the names of the buses a strip can be routed to,
+// physical buses first (e.g. "A1", "A2", "A3", "B1", "B2").
+func OutputBuses(vm *voicemeeter.Remote) []string {
+	buses := make([]string, 0, vm.Kind.PhysOut+vm.Kind.VirtOut)
+	for i := 1; i <= vm.Kind.PhysOut; i++ {
+		buses = append(buses, fmt.Sprintf("A%d", i))
+	}
+	for i := 1; i <= vm.Kind.VirtOut; i++ {
+		buses = append(buses, fmt.Sprintf("B%d", i))
+	}
+	return buses
+}
+
+func checkStripOutput(vm *voicemeeter.Remote, stripIndex int, bus string) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+	if stripIndex >= len(vm.Strip) || stripIndex < 0 {
+		log.Printf("stripIndex %v is out of range\n", stripIndex)
+		return fmt.Errorf("stripIndex %v is out of range", stripIndex)
+	}
+	if !slices.Contains(OutputBuses(vm), bus) {
+		log.Printf("unknown bus: '%v'\n", bus)
+		return fmt.Errorf("unknown bus: '%v'", bus)
+	}
+	return nil
+}
+
+func GetStripOutput(vm *voicemeeter.Remote, stripIndex int, bus string) (bool, error) {
+	if err := checkStripOutput(vm, stripIndex, bus); err != nil {
+		return false, err
+	}
+
+	strip := vm.Strip[stripIndex]
+	switch bus {
+	case "A1":
+		return strip.A1(), nil
+	case "A2":
+		return strip.A2(), nil
+	case "A3":
+		return strip.A3(), nil
+	case "A4":
+		return strip.A4(), nil
+	case "A5":
+		return strip.A5(), nil
+	case "B1":
+		return strip.B1(), nil
+	case "B2":
+		return strip.B2(), nil
+	case "B3":
+		return strip.B3(), nil
+	}
+	return false, nil
+}
+
+func SetStripOutput(vm *voicemeeter.Remote, stripIndex int, bus string, on bool) error {
+	if err := checkStripOutput(vm, stripIndex, bus); err != nil {
+		return err
+	}
+
+	strip := vm.Strip[stripIndex]
+	switch bus {
+	case "A1":
+		strip.SetA1(on)
+	case "A2":
+		strip.SetA2(on)
+	case "A3":
+		strip.SetA3(on)
+	case "A4":
+		strip.SetA4(on)
+	case "A5":
+		strip.SetA5(on)
+	case "B1":
+		strip.SetB1(on)
+	case "B2":
+		strip.SetB2(on)
+	case "B3":
+		strip.SetB3(on)
+	}
+	return nil
+}
+
+// ToggleStripOutput flips the routing to the bus and returns the new state.
+func ToggleStripOutput(vm *voicemeeter.Remote, stripIndex int, bus string) (bool, error) {
+	on, err := GetStripOutput(vm, stripIndex, bus)
+	if err != nil {
+		return false, err
+	}
+	if err := SetStripOutput(vm, stripIndex, bus, !on); err != nil {
+		return false, err
+	}
+	return !on, nil
+}
+
+// GetStripRouting returns the buses the strip is currently routed to.
+func GetStripRouting(vm *voicemeeter.Remote, stripIndex int) ([]string, error) {
+	routing := []string{}
+	for _, bus := range OutputBuses(vm) {
+		on, err := GetStripOutput(vm, stripIndex, bus)
+		if err != nil {
+			return nil, err
+		}
+		if on {
+			routing = append(routing, bus)
+		}
+	}
+	return routing, nil
+}
+
+// SetStripRouting routes the strip to exactly the given buses.
+// Buses not available in the running Voicemeeter kind are ignored.
+func SetStripRouting(vm *voicemeeter.Remote, stripIndex int, routing []string) error {
+	for _, bus := range OutputBuses(vm) {
+		if err := SetStripOutput(vm, stripIndex, bus, slices.Contains(routing, bus)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseRoutingPresets parses one preset per line, each a comma or space
+// separated list of bus names such as "A1, B1". A line of "-" stands for a
+// preset with no bus, and blank lines are skipped. Bus names not in buses
+// are rejected.
+func ParseRoutingPresets(s string, buses []string) ([][]string, error) {
+	presets := [][]string{}
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		preset := []string{}
+		for _, bus := range strings.FieldsFunc(line, func(r rune) bool { return r == ',' || r == ' ' }) {
+			bus = strings.ToUpper(bus)
+			if bus == "-" || slices.Contains(preset, bus) {
+				continue
+			}
+			if !slices.Contains(buses, bus) {
+				return nil, fmt.Errorf("unknown bus '%v' in preset %d", bus, len(presets)+1)
+			}
+			preset = append(preset, bus)
+		}
+		presets = append(presets, preset)
+	}
+	if len(presets) == 0 {
+		return nil, fmt.Errorf("no routing presets")
+	}
+	return presets, nil
+}
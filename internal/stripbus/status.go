@@ -13,6 +13,7 @@ import (
 
 type IStripOrBusStatus interface {
 	RenderIndicator() (image.Image, error)
+	Flag(flag string) (bool, error)
 }
 
 type StripStatus struct {
@@ -25,6 +26,7 @@ type StripStatus struct {
 	Mono       bool
 	Eq         bool
 	Mc         bool
+	Karaoke    bool
 }
 
 type BusStatus struct {
@@ -83,6 +85,7 @@ func GetStripStatus(vm *voicemeeter.Remote, stripIndex int) (*StripStatus, error
 			ss.Mono = strip.Mono()
 		} else {
 			ss.Mc = strip.Mc()
+			ss.Karaoke = getKaraoke(vm, stripIndex)
 		}
 
 	case "potato":
@@ -99,6 +102,7 @@ func GetStripStatus(vm *voicemeeter.Remote, stripIndex int) (*StripStatus, error
 			ss.Eq = strip.Eq().On()
 		} else {
 			ss.Mc = strip.Mc()
+			ss.Karaoke = getKaraoke(vm, stripIndex)
 		}
 	}
 
@@ -0,0 +1,175 @@
+// Package vban switches VBAN streams and the global VBAN enable, and reads
+// the stream settings shown on the deck.
+package vban
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+)
+
+const (
+	DirectionIn  = "in"
+	DirectionOut = "out"
+)
+
+// Stream is a snapshot of a VBAN stream.
+type Stream struct {
+	Direction string
+	Index     int
+	Name      string
+	Ip        string
+	Port      int
+	On        bool
+}
+
+// Address returns the IP address and the port as "ip:port".
+func (s *Stream) Address() string {
+	return fmt.Sprintf("%v:%v", s.Ip, s.Port)
+}
+
+type stream interface {
+	On() bool
+	SetOn(val bool)
+	Name() string
+	Ip() string
+	Port() int
+}
+
+func getStream(vm *voicemeeter.Remote, direction string, index int) (stream, error) {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return nil, fmt.Errorf("vm is nil")
+	}
+
+	count, err := StreamCount(vm, direction)
+	if err != nil {
+		return nil, err
+	}
+	if index >= count || index < 0 {
+		log.Printf("vban %v-stream index %v is out of range\n", direction, index)
+		return nil, fmt.Errorf("vban %v-stream index %v is out of range", direction, index)
+	}
+
+	switch direction {
+	case DirectionIn:
+		return vm.Vban.InStream[index], nil
+	default:
+		return vm.Vban.OutStream[index], nil
+	}
+}
+
+// StreamCount returns the number of streams in the direction.
+func StreamCount(vm *voicemeeter.Remote, direction string) (int, error) {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return 0, fmt.Errorf("vm is nil")
+	}
+
+	switch direction {
+	case DirectionIn:
+		return len(vm.Vban.InStream), nil
+	case DirectionOut:
+		return len(vm.Vban.OutStream), nil
+	default:
+		log.Printf("unknown vban direction: '%v'\n", direction)
+		return 0, fmt.Errorf("unknown vban direction: '%v'", direction)
+	}
+}
+
+// GetStream reads the settings and the on/off state of a stream.
+func GetStream(vm *voicemeeter.Remote, direction string, index int) (*Stream, error) {
+	s, err := getStream(vm, direction, index)
+	if err != nil {
+		return nil, err
+	}
+	return &Stream{
+		Direction: direction,
+		Index:     index,
+		Name:      s.Name(),
+		Ip:        s.Ip(),
+		Port:      s.Port(),
+		On:        s.On(),
+	}, nil
+}
+
+// GetStreams reads all streams in the direction.
+func GetStreams(vm *voicemeeter.Remote, direction string) ([]*Stream, error) {
+	count, err := StreamCount(vm, direction)
+	if err != nil {
+		return nil, err
+	}
+	streams := make([]*Stream, 0, count)
+	for i := 0; i < count; i++ {
+		s, err := GetStream(vm, direction, i)
+		if err != nil {
+			return nil, err
+		}
+		streams = append(streams, s)
+	}
+	return streams, nil
+}
+
+// SetStreamOn turns a stream on or off.
+func SetStreamOn(vm *voicemeeter.Remote, direction string, index int, on bool) error {
+	s, err := getStream(vm, direction, index)
+	if err != nil {
+		return err
+	}
+	s.SetOn(on)
+	return nil
+}
+
+// ToggleStreamOn inverts the on/off state of a stream and returns the new
+// state.
+func ToggleStreamOn(vm *voicemeeter.Remote, direction string, index int) (bool, error) {
+	s, err := getStream(vm, direction, index)
+	if err != nil {
+		return false, err
+	}
+	on := !s.On()
+	s.SetOn(on)
+	return on, nil
+}
+
+// GetEnabled reports whether VBAN is enabled globally.
+func GetEnabled(vm *voicemeeter.Remote) (bool, error) {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return false, fmt.Errorf("vm is nil")
+	}
+	val, err := vm.GetFloat("vban.Enable")
+	if err != nil {
+		log.Printf("error getting vban.Enable: %v\n", err)
+		return false, err
+	}
+	return val != 0, nil
+}
+
+// SetEnabled switches VBAN globally.
+func SetEnabled(vm *voicemeeter.Remote, on bool) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+	if on {
+		vm.Vban.Enable()
+	} else {
+		vm.Vban.Disable()
+	}
+	return nil
+}
+
+// ToggleEnabled inverts the global VBAN switch and returns the new state.
+func ToggleEnabled(vm *voicemeeter.Remote) (bool, error) {
+	on, err := GetEnabled(vm)
+	if err != nil {
+		return false, err
+	}
+	on = !on
+	if err := SetEnabled(vm, on); err != nil {
+		return false, err
+	}
+	return on, nil
+}
@@ -0,0 +1,106 @@
+// Package vmevent shares one Voicemeeter observer among all actions. The
+// voicemeeter package keeps its observers in a slice the pooler reads without
+// a lock, so the observer is registered once, before the actions start, and
+// every event is passed on to the subscribers from here.
+package vmevent
+
+import (
+	"slices"
+	"sync"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+)
+
+var (
+	mu        sync.Mutex
+	subs      []*subscriber
+	startOnce sync.Once
+)
+
+// A subscriber queues the events its receiver has not taken yet. The events
+// only tell that something has changed, like "pdirty", so an event already
+// queued is not queued again; a slow receiver gets each kind of change once
+// and never holds up the others or the pooler.
+type subscriber struct {
+	c    chan string
+	wake chan struct{}
+
+	mu      sync.Mutex
+	pending []string // in order of arrival, each event at most once
+}
+
+// Start registers the observer. It must be called before the goroutines of
+// the actions start.
+func Start(vm *voicemeeter.Remote) {
+	startOnce.Do(func() {
+		ch := make(chan string)
+		vm.Register(ch)
+		go run(ch)
+	})
+}
+
+// Subscribe returns a channel receiving the events of Voicemeeter, such as
+// "pdirty" and "mdirty". Events of a kind already waiting for the receiver
+// are dropped. The channel is closed when Voicemeeter stops sending events.
+func Subscribe() <-chan string {
+	s := &subscriber{
+		c:    make(chan string),
+		wake: make(chan struct{}, 1),
+	}
+	go s.deliver()
+
+	mu.Lock()
+	defer mu.Unlock()
+	subs = append(subs, s)
+	return s.c
+}
+
+func run(ch chan string) {
+	for e := range ch {
+		mu.Lock()
+		receivers := slices.Clone(subs)
+		mu.Unlock()
+		for _, s := range receivers {
+			s.push(e)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, s := range subs {
+		close(s.wake)
+	}
+	subs = nil
+}
+
+func (s *subscriber) push(e string) {
+	s.mu.Lock()
+	if !slices.Contains(s.pending, e) {
+		s.pending = append(s.pending, e)
+	}
+	s.mu.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// deliver hands the queued events to the receiver until the observer stops.
+func (s *subscriber) deliver() {
+	for range s.wake {
+		for {
+			s.mu.Lock()
+			if len(s.pending) == 0 {
+				s.mu.Unlock()
+				break
+			}
+			e := s.pending[0]
+			s.pending = s.pending[1:]
+			s.mu.Unlock()
+
+			s.c <- e
+		}
+	}
+	close(s.c)
+}
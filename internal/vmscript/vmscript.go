@@ -0,0 +1,105 @@
+// Package vmscript checks Voicemeeter scripts against the running edition
+// before they are sent, because Voicemeeter silently ignores statements it
+// cannot apply.
+package vmscript
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/onyx-and-iris/voicemeeter/v2"
+
+	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vban"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmsyntax"
+)
+
+// edition describes the edition vm is logged in to.
+func edition(vm *voicemeeter.Remote) vmsyntax.Edition {
+	vbanIn, _ := vban.StreamCount(vm, vban.DirectionIn)
+	vbanOut, _ := vban.StreamCount(vm, vban.DirectionOut)
+	return vmsyntax.Edition{
+		Name:        vm.Kind.String(),
+		Strips:      len(vm.Strip),
+		Buses:       len(vm.Bus),
+		Outputs:     stripbus.OutputBuses(vm),
+		VbanIn:      vbanIn,
+		VbanOut:     vbanOut,
+		HasRecorder: vm.Recorder != nil,
+	}
+}
+
+// Validate checks the syntax of every statement, and the indices of strips,
+// buses, outputs and VBAN streams against the edition vm is logged in to.
+func Validate(vm *voicemeeter.Remote, script string) error {
+	if vm == nil {
+		log.Printf("vm is nil\n")
+		return fmt.Errorf("vm is nil")
+	}
+
+	return vmsyntax.Check(edition(vm), script)
+}
+
+// Run validates the script and sends it to Voicemeeter.
+func Run(vm *voicemeeter.Remote, script string) error {
+	if err := Validate(vm, script); err != nil {
+		log.Printf("invalid script: %v\n", err)
+		return err
+	}
+	if err := vm.SendText(strings.Join(vmsyntax.Split(script), ";")); err != nil {
+		log.Printf("error sending script: %v\n", err)
+		return err
+	}
+	return nil
+}
+
+// matchTolerance is how far a parameter may be from the value a script sets
+// and still count as set, since Voicemeeter rounds some values.
+const matchTolerance = 0.05
+
+// Matches reports whether the parameters currently hold the values the
+// script sets. Relative statements ("+=", "-=") are not compared. A script
+// without any absolute statement never matches.
+func Matches(vm *voicemeeter.Remote, script string) (bool, error) {
+	if err := Validate(vm, script); err != nil {
+		return false, err
+	}
+
+	compared := 0
+	for _, statement := range vmsyntax.Split(script) {
+		a, err := vmsyntax.ParseStatement(statement)
+		if err != nil {
+			return false, err
+		}
+		if a.Operator != "=" {
+			continue
+		}
+
+		if a.IsString() {
+			current, err := vm.GetString(a.Name)
+			if err != nil {
+				return false, err
+			}
+			if current != strings.Trim(a.Value, `"`) {
+				return false, nil
+			}
+		} else {
+			want, err := strconv.ParseFloat(a.Value, 64)
+			if err != nil {
+				return false, fmt.Errorf("'%v': value is not a number", statement)
+			}
+			current, err := vm.GetFloat(a.Name)
+			if err != nil {
+				return false, err
+			}
+			if math.Abs(current-want) > matchTolerance {
+				return false, nil
+			}
+		}
+		compared++
+	}
+	return compared > 0, nil
+}
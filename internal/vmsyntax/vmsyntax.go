@@ -0,0 +1,206 @@
+// Package vmsyntax parses Voicemeeter scripts and checks them against the
+// strips, buses and streams of an edition, without talking to Voicemeeter.
+package vmsyntax
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var (
+	// e.g. "Strip[0].Mute=1", "Bus(1).Gain += 3", "Strip[2].Label = "Mic""
+	statementPattern = regexp.MustCompile(`^([A-Za-z][\w.\[\]()]*?)\s*(=|\+=|-=)\s*(.+)$`)
+	// e.g. "Strip[0]", "Bus(1)", "Mute"
+	segmentPattern = regexp.MustCompile(`^([A-Za-z]\w*)(?:\[(\d+)\]|\((\d+)\))?$`)
+)
+
+// Error describes the statement a script failed on.
+type Error struct {
+	Statement string
+	Err       error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("'%v': %v", e.Statement, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Assignment is a statement split into its parts, e.g. "Bus[1].Gain", "+="
+// and "3".
+type Assignment struct {
+	Name     string
+	Operator string // "=" | "+=" | "-="
+	Value    string
+}
+
+// ParseStatement splits a single statement. It does not check the indices.
+func ParseStatement(statement string) (Assignment, error) {
+	m := statementPattern.FindStringSubmatch(strings.TrimSpace(statement))
+	if m == nil {
+		return Assignment{}, fmt.Errorf("expected 'Parameter=Value'")
+	}
+	a := Assignment{Name: m[1], Operator: m[2], Value: strings.TrimSpace(m[3])}
+	if strings.Count(a.Value, `"`)%2 != 0 {
+		return Assignment{}, fmt.Errorf("unterminated string %v", a.Value)
+	}
+	return a, nil
+}
+
+// IsString reports whether the value is a quoted string.
+func (a Assignment) IsString() bool {
+	return strings.HasPrefix(a.Value, `"`)
+}
+
+// Split splits a script into statements on ';', ',' and line breaks outside
+// of quotes. Empty statements are dropped.
+func Split(script string) []string {
+	statements := []string{}
+	var b strings.Builder
+	quoted := false
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			statements = append(statements, s)
+		}
+		b.Reset()
+	}
+	for _, r := range script {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			b.WriteRune(r)
+		case !quoted && (r == ';' || r == ',' || r == '\n' || r == '\r'):
+			flush()
+		default:
+			b.WriteRune(r)
+		}
+	}
+	flush()
+	return statements
+}
+
+// Edition describes what a Voicemeeter edition has, as far as scripts can
+// address it.
+type Edition struct {
+	Name        string   // e.g. "Banana"
+	Strips      int      // number of strips
+	Buses       int      // number of buses
+	Outputs     []string // buses a strip can be routed to, e.g. "A1", "B1"
+	VbanIn      int      // number of VBAN in-streams
+	VbanOut     int      // number of VBAN out-streams
+	HasRecorder bool
+}
+
+// Check checks the syntax of every statement, and the indices of strips,
+// buses, outputs and VBAN streams against the edition.
+func Check(edition Edition, script string) error {
+	statements := Split(script)
+	if len(statements) == 0 {
+		return fmt.Errorf("script is empty")
+	}
+	for _, statement := range statements {
+		if err := checkStatement(edition, statement); err != nil {
+			return &Error{Statement: statement, Err: err}
+		}
+	}
+	return nil
+}
+
+type segment struct {
+	name     string
+	index    int
+	hasIndex bool
+}
+
+func parseSegments(name string) ([]segment, error) {
+	parts := strings.Split(name, ".")
+	segments := make([]segment, 0, len(parts))
+	for _, part := range parts {
+		m := segmentPattern.FindStringSubmatch(part)
+		if m == nil {
+			return nil, fmt.Errorf("invalid parameter name '%v'", name)
+		}
+		seg := segment{name: m[1]}
+		if digits := m[2] + m[3]; digits != "" {
+			index, err := strconv.Atoi(digits)
+			if err != nil {
+				return nil, err
+			}
+			seg.index = index
+			seg.hasIndex = true
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+func checkStatement(edition Edition, statement string) error {
+	a, err := ParseStatement(statement)
+	if err != nil {
+		return err
+	}
+	segments, err := parseSegments(a.Name)
+	if err != nil {
+		return err
+	}
+
+	head := segments[0]
+	switch {
+	case strings.EqualFold(head.name, "Strip"):
+		if err := checkIndex(head, "strip", edition.Strips); err != nil {
+			return err
+		}
+		if len(segments) == 2 && isOutputName(segments[1].name) {
+			if !slices.ContainsFunc(edition.Outputs, func(bus string) bool {
+				return strings.EqualFold(bus, segments[1].name)
+			}) {
+				return fmt.Errorf("bus %v does not exist in Voicemeeter %v", segments[1].name, edition.Name)
+			}
+		}
+
+	case strings.EqualFold(head.name, "Bus"):
+		return checkIndex(head, "bus", edition.Buses)
+
+	case strings.EqualFold(head.name, "vban"):
+		if len(segments) < 2 {
+			return fmt.Errorf("invalid parameter name '%v'", a.Name)
+		}
+		stream := segments[1]
+		switch {
+		case strings.EqualFold(stream.name, "instream"):
+			return checkIndex(stream, "vban in-stream", edition.VbanIn)
+		case strings.EqualFold(stream.name, "outstream"):
+			return checkIndex(stream, "vban out-stream", edition.VbanOut)
+		}
+
+	case strings.EqualFold(head.name, "Recorder"):
+		if !edition.HasRecorder {
+			return fmt.Errorf("Voicemeeter %v has no recorder", edition.Name)
+		}
+	}
+	return nil
+}
+
+func checkIndex(seg segment, what string, count int) error {
+	if !seg.hasIndex {
+		return fmt.Errorf("%v index is missing", what)
+	}
+	if seg.index >= count {
+		return fmt.Errorf("%v index %v is out of range (0-%v)", what, seg.index, count-1)
+	}
+	return nil
+}
+
+// isOutputName reports whether name looks like a strip output such as "A1"
+// or "B2".
+func isOutputName(name string) bool {
+	if len(name) != 2 {
+		return false
+	}
+	return strings.ContainsRune("AaBb", rune(name[0])) && name[1] >= '1' && name[1] <= '9'
+}
@@ -0,0 +1,131 @@
+package vmsyntax
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+var banana = Edition{
+	Name:        "Banana",
+	Strips:      5,
+	Buses:       5,
+	Outputs:     []string{"A1", "A2", "A3", "B1", "B2"},
+	VbanIn:      8,
+	VbanOut:     8,
+	HasRecorder: true,
+}
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{
+			name:   "separators",
+			script: "Strip[0].Mute=1;Strip[1].Mute=0,Bus[0].Mono=1\nBus[1].Eq.On=1\r\nStrip[2].A1=1",
+			want:   []string{"Strip[0].Mute=1", "Strip[1].Mute=0", "Bus[0].Mono=1", "Bus[1].Eq.On=1", "Strip[2].A1=1"},
+		},
+		{
+			name:   "empty statements dropped",
+			script: " ;; Strip[0].Mute=1 ;\n\n",
+			want:   []string{"Strip[0].Mute=1"},
+		},
+		{
+			name:   "separators inside quotes kept",
+			script: `Strip[0].Label="Mic; Desk, Left";Strip[1].Mute=1`,
+			want:   []string{`Strip[0].Label="Mic; Desk, Left"`, "Strip[1].Mute=1"},
+		},
+		{
+			name:   "empty",
+			script: "",
+			want:   []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Split(tt.script); !slices.Equal(got, tt.want) {
+				t.Errorf("Split(%q) = %q, want %q", tt.script, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      Assignment
+		wantErr   bool
+	}{
+		{statement: "Strip[0].Mute=1", want: Assignment{Name: "Strip[0].Mute", Operator: "=", Value: "1"}},
+		{statement: " Bus(1).Gain += 3 ", want: Assignment{Name: "Bus(1).Gain", Operator: "+=", Value: "3"}},
+		{statement: "Bus[1].Gain-=1.5", want: Assignment{Name: "Bus[1].Gain", Operator: "-=", Value: "1.5"}},
+		{statement: `Strip[2].Label = "Mic"`, want: Assignment{Name: "Strip[2].Label", Operator: "=", Value: `"Mic"`}},
+		{statement: `Strip[2].Label="Mic`, wantErr: true},
+		{statement: "Strip[0].Mute", wantErr: true},
+		{statement: "=1", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.statement, func(t *testing.T) {
+			got, err := ParseStatement(tt.statement)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseStatement(%q) error = %v, wantErr %v", tt.statement, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseStatement(%q) = %+v, want %+v", tt.statement, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssignmentIsString(t *testing.T) {
+	if a := (Assignment{Value: `"Mic"`}); !a.IsString() {
+		t.Errorf("%+v: IsString() = false, want true", a)
+	}
+	if a := (Assignment{Value: "1"}); a.IsString() {
+		t.Errorf("%+v: IsString() = true, want false", a)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name    string
+		edition Edition
+		script  string
+		wantErr bool
+	}{
+		{name: "valid", edition: banana, script: `Strip[4].Mute=1;Bus(4).Gain+=3;Strip[0].B2=1;Strip[1].Label="Mic"`},
+		{name: "empty", edition: banana, script: " ; ", wantErr: true},
+		{name: "syntax", edition: banana, script: "Strip[0].Mute", wantErr: true},
+		{name: "strip out of range", edition: banana, script: "Strip[5].Mute=1", wantErr: true},
+		{name: "bus out of range", edition: banana, script: "Bus[5].Mute=1", wantErr: true},
+		{name: "missing index", edition: banana, script: "Strip.Mute=1", wantErr: true},
+		{name: "unknown output", edition: banana, script: "Strip[0].B3=1", wantErr: true},
+		{name: "vban stream", edition: banana, script: "vban.instream[7].on=1;vban.outstream[0].on=0"},
+		{name: "vban stream out of range", edition: banana, script: "vban.outstream[8].on=1", wantErr: true},
+		{name: "vban without stream", edition: banana, script: "vban=1", wantErr: true},
+		{name: "recorder", edition: banana, script: "Recorder.Play=1"},
+		{name: "no recorder", edition: Edition{Name: "Basic", Strips: 3, Buses: 2}, script: "Recorder.Play=1", wantErr: true},
+		{name: "other parameters unchecked", edition: banana, script: "Command.Restart=1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Check(tt.edition, tt.script)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Check(%q) error = %v, wantErr %v", tt.script, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckNamesStatement(t *testing.T) {
+	err := Check(banana, "Strip[0].Mute=1;Strip[9].Mute=1")
+	var e *Error
+	if !errors.As(err, &e) {
+		t.Fatalf("Check() error = %v, want *Error", err)
+	}
+	if e.Statement != "Strip[9].Mute=1" {
+		t.Errorf("Statement = %q, want %q", e.Statement, "Strip[9].Mute=1")
+	}
+}
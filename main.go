@@ -7,24 +7,49 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/hrko/streamdeck"
 	sdcontext "github.com/hrko/streamdeck/context"
 	"github.com/onyx-and-iris/voicemeeter/v2"
 
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/config_file"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/device_select"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/ducking_rule"
 	"github.com/hrko/streamdeck-voicemeeter/internal/action/gain_controll"
 	"github.com/hrko/streamdeck-voicemeeter/internal/action/gain_controll_combo"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/gain_key"
 	"github.com/hrko/streamdeck-voicemeeter/internal/action/macro"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/multi_state"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/push_to_talk"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/recorder_transport"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/restart"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/routing"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/scene_recall"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/script"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/sequence_key"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/toggle_flag"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/toggle_mute"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/vban_stream"
+	"github.com/hrko/streamdeck-voicemeeter/internal/action/voice_activity"
+	"github.com/hrko/streamdeck-voicemeeter/internal/globalsettings"
+	"github.com/hrko/streamdeck-voicemeeter/internal/levelstream"
+	"github.com/hrko/streamdeck-voicemeeter/internal/scene"
+	"github.com/hrko/streamdeck-voicemeeter/internal/stripbus"
+	"github.com/hrko/streamdeck-voicemeeter/internal/vmevent"
 	"github.com/hrko/streamdeck-voicemeeter/pkg/graphics"
 )
 
 var (
 	chGlobalSettings chan *GlobalSettings
+	iconFontDirMu    sync.Mutex
+	iconFontDir      string // the icon font folder of the global settings
 )
 
 type GlobalSettings struct {
 	VoiceMeeterKind string `json:"voiceMeeterKind"`
+	IconFontDir     string `json:"iconFontDir"`
 }
 
 func main() {
@@ -34,6 +59,10 @@ func main() {
 
 	cacheDir := setupPluginCacheDir()
 	graphics.SetMaterialSymbolsCacheDir(cacheDir)
+	setIconFontSources("")
+	dataDir := setupPluginDataDir()
+	scene.SetStoreDir(dataDir)
+	config_file.SetBackupDir(filepath.Join(dataDir, "backups"))
 
 	ctx := context.Background()
 	log.Println("Starting voicemeeter-streamdeck-plugin")
@@ -56,6 +85,50 @@ func setupPluginCacheDir() string {
 	return cacheDir
 }
 
+// setIconFontSources looks up Material Symbols fonts in the directory set by
+// the user, then in the fonts shipped with the plugin. Google Fonts is the
+// last resort.
+func setIconFontSources(userDir string) {
+	sources := []graphics.FontSource{}
+	if userDir != "" {
+		sources = append(sources, graphics.FontDir(userDir))
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		log.Printf("error getting executable path: %v\n", err)
+	} else {
+		sources = append(sources, graphics.FontDir(filepath.Join(filepath.Dir(exe), "fonts")))
+	}
+	graphics.SetMaterialSymbolsFontSources(sources...)
+}
+
+// updateIconFontDir sets the icon font sources again if the folder in the
+// global settings has changed. Setting them drops every font and icon loaded
+// so far, so it is not done for other changes of the global settings.
+func updateIconFontDir(userDir string) {
+	iconFontDirMu.Lock()
+	defer iconFontDirMu.Unlock()
+	if userDir == iconFontDir {
+		return
+	}
+	iconFontDir = userDir
+	setIconFontSources(userDir)
+}
+
+func setupPluginDataDir() string {
+	userConfigDir := ""
+	userConfigDir, err := os.UserConfigDir()
+	if err != nil {
+		log.Printf("error getting user config dir: %v, fallback to temp dir\n", err)
+		userConfigDir = os.TempDir()
+	}
+	dataDir := filepath.Join(userConfigDir, "streamdeck-voicemeeter")
+	if err := os.MkdirAll(dataDir, 0755); err != nil {
+		log.Printf("error creating data dir: %v\n", err)
+	}
+	return dataDir
+}
+
 func run(ctx context.Context) error {
 	params, err := streamdeck.ParseRegistrationParams(os.Args)
 	if err != nil {
@@ -70,6 +143,22 @@ func run(ctx context.Context) error {
 	gain_controll.SetupPreClientRun(client)
 	gain_controll_combo.SetupPreClientRun(client)
 	macro.SetupPreClientRun(client)
+	toggle_mute.SetupPreClientRun(client)
+	gain_key.SetupPreClientRun(client)
+	restart.SetupPreClientRun(client)
+	routing.SetupPreClientRun(client)
+	toggle_flag.SetupPreClientRun(client)
+	push_to_talk.SetupPreClientRun(client)
+	scene_recall.SetupPreClientRun(client)
+	config_file.SetupPreClientRun(client)
+	recorder_transport.SetupPreClientRun(client)
+	vban_stream.SetupPreClientRun(client)
+	device_select.SetupPreClientRun(client)
+	ducking_rule.SetupPreClientRun(client)
+	voice_activity.SetupPreClientRun(client)
+	script.SetupPreClientRun(client)
+	sequence_key.SetupPreClientRun(client)
+	multi_state.SetupPreClientRun(client)
 
 	chErr := make(chan error)
 	go func() {
@@ -90,10 +179,30 @@ func run(ctx context.Context) error {
 	}
 	defer vm.Logout()
 	vm.EventAdd("ldirty")
+	levelstream.Start(func(source levelstream.Source) ([]float64, error) {
+		return stripbus.GetLevels(vm, source.Kind, source.Index)
+	})
+	vmevent.Start(vm)
 
 	go gain_controll.SetupPostClientRun(client, vm)
 	go gain_controll_combo.SetupPostClientRun(client, vm)
 	go macro.SetupPostClientRun(client, vm)
+	go toggle_mute.SetupPostClientRun(client, vm)
+	go gain_key.SetupPostClientRun(client, vm)
+	go restart.SetupPostClientRun(client, vm)
+	go routing.SetupPostClientRun(client, vm)
+	go toggle_flag.SetupPostClientRun(client, vm)
+	go push_to_talk.SetupPostClientRun(client, vm)
+	go scene_recall.SetupPostClientRun(client, vm)
+	go config_file.SetupPostClientRun(client, vm)
+	go recorder_transport.SetupPostClientRun(client, vm)
+	go vban_stream.SetupPostClientRun(client, vm)
+	go device_select.SetupPostClientRun(client, vm)
+	go ducking_rule.SetupPostClientRun(client, vm)
+	go voice_activity.SetupPostClientRun(client, vm)
+	go script.SetupPostClientRun(client, vm)
+	go sequence_key.SetupPostClientRun(client, vm)
+	go multi_state.SetupPostClientRun(client, vm)
 
 	return <-chErr
 }
@@ -102,15 +211,29 @@ func registerNoActionHandlers(client *streamdeck.Client) {
 	chGlobalSettings = make(chan *GlobalSettings)
 	client.RegisterNoActionHandler(streamdeck.DidReceiveGlobalSettings, func(ctx context.Context, client *streamdeck.Client, event streamdeck.Event) error {
 		payload := new(struct {
-			Settings *GlobalSettings `json:"settings"`
+			Settings json.RawMessage `json:"settings"`
 		})
 		err := json.Unmarshal(event.Payload, payload)
 		if err != nil {
 			log.Printf("error unmarshaling payload: %v\n", err)
 			return err
 		}
+		if err := globalsettings.Update(payload.Settings); err != nil {
+			log.Printf("error unmarshaling global settings: %v\n", err)
+			return err
+		}
+		var settings *GlobalSettings
+		if len(payload.Settings) > 0 {
+			if err := json.Unmarshal(payload.Settings, &settings); err != nil {
+				log.Printf("error unmarshaling global settings: %v\n", err)
+				return err
+			}
+		}
+		if settings != nil {
+			updateIconFontDir(settings.IconFontDir)
+		}
 		select {
-		case chGlobalSettings <- payload.Settings:
+		case chGlobalSettings <- settings:
 			log.Println("global settings received and sent to channel")
 		default:
 			log.Println("global settings received but no one is waiting for channel")
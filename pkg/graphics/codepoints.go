@@ -0,0 +1,155 @@
+package graphics
+
+import (
+	"bufio"
+	"bytes"
+	_ "embed"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// The embedded table comes from the ".codepoints" file Google Fonts
+// distributes with the fonts; `task codepoints` updates it. The tables found
+// in the font sources, like the ones `task fonts` puts in the fonts folder,
+// are merged into it.
+//
+//go:embed material_symbols.codepoints
+var embeddedCodepoints []byte
+
+var (
+	codepointsMu sync.Mutex
+	codepoints   map[string]string // key: icon name, value: code point in hex
+
+	// Material Symbols are in the private use areas, U+E000 to U+F8FF and
+	// from U+F0000; shorter hex like "add" or "face" is taken for a typo of
+	// a name rather than a code point
+	codePointRegexp = regexp.MustCompile(`^[0-9a-f]{4,5}$`)
+)
+
+// IconName is an icon found by SearchIcons.
+type IconName struct {
+	Name      string `json:"name"`
+	CodePoint string `json:"codePoint"`
+}
+
+// CodepointsSource is a FontSource that also provides a codepoints table in
+// the format of Google Fonts: one "<name> <code point>" per line.
+type CodepointsSource interface {
+	Codepoints() ([]byte, error)
+}
+
+// Codepoints returns the first "MaterialSymbols*.codepoints" file in the
+// directory, or ErrFontNotFound.
+func (d FontDir) Codepoints() ([]byte, error) {
+	if d == "" {
+		return nil, ErrFontNotFound
+	}
+	paths, err := filepath.Glob(filepath.Join(string(d), "MaterialSymbols*.codepoints"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, ErrFontNotFound
+	}
+	return os.ReadFile(paths[0])
+}
+
+// ResolveCodePoint returns the code point of an icon given by its name, like
+// "mic_off", or by its code point as 4 or 5 hex digits, like "e02b".
+func ResolveCodePoint(nameOrCode string) (rune, error) {
+	s := strings.ToLower(strings.TrimSpace(nameOrCode))
+	// names come first; a few of them, like "face", are valid hex too
+	if code, ok := getCodepoints()[s]; ok {
+		s = code
+	} else if !codePointRegexp.MatchString(s) {
+		return 0, fmt.Errorf("unknown icon '%v'", nameOrCode)
+	}
+	codeInt, err := strconv.ParseInt(s, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("unknown icon '%v'", nameOrCode)
+	}
+	return rune(codeInt), nil
+}
+
+// SearchIcons returns up to limit icons whose names contain the query. Names
+// starting with the query come first.
+func SearchIcons(query string, limit int) []IconName {
+	query = strings.ToLower(strings.TrimSpace(query))
+	query = strings.ReplaceAll(query, " ", "_")
+
+	prefixed := []IconName{}
+	contained := []IconName{}
+	for name, code := range getCodepoints() {
+		switch {
+		case strings.HasPrefix(name, query):
+			prefixed = append(prefixed, IconName{name, code})
+		case strings.Contains(name, query):
+			contained = append(contained, IconName{name, code})
+		}
+	}
+	byName := func(a, b IconName) int {
+		return strings.Compare(a.Name, b.Name)
+	}
+	slices.SortFunc(prefixed, byName)
+	slices.SortFunc(contained, byName)
+
+	icons := append(prefixed, contained...)
+	if len(icons) > limit {
+		icons = icons[:limit]
+	}
+	return icons
+}
+
+// getCodepoints loads the embedded table and the tables of the local sources
+// on first use.
+func getCodepoints() map[string]string {
+	codepointsMu.Lock()
+	defer codepointsMu.Unlock()
+	if codepoints != nil {
+		return codepoints
+	}
+
+	codepoints = map[string]string{}
+	parseCodepoints(codepoints, embeddedCodepoints)
+
+	fontSourcesMu.RLock()
+	sources := localSources
+	fontSourcesMu.RUnlock()
+	for _, source := range sources {
+		cs, ok := source.(CodepointsSource)
+		if !ok {
+			continue
+		}
+		data, err := cs.Codepoints()
+		if err != nil {
+			continue
+		}
+		parseCodepoints(codepoints, data)
+	}
+	return codepoints
+}
+
+func parseCodepoints(table map[string]string, data []byte) {
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		table[fields[0]] = strings.ToLower(fields[1])
+	}
+}
+
+// resetCodepoints makes the next lookup reload the tables. Called when the
+// font sources change.
+func resetCodepoints() {
+	codepointsMu.Lock()
+	defer codepointsMu.Unlock()
+	codepoints = nil
+}
@@ -0,0 +1,84 @@
+package graphics
+
+import (
+	"testing"
+
+	"github.com/tdewolff/canvas"
+)
+
+func TestResolveCodePoint(t *testing.T) {
+	setFontSources(t, nil)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    rune
+		wantErr bool
+	}{
+		{name: "name", input: "home", want: 0xe88a},
+		{name: "name in other case with spaces", input: " HOME ", want: 0xe88a},
+		{name: "name that is valid hex", input: "add", want: 0xe145},
+		{name: "4 hex digits", input: "e88a", want: 0xe88a},
+		{name: "5 hex digits", input: "F0EF4", want: 0xf0ef4},
+		{name: "too few hex digits", input: "e88", wantErr: true},
+		{name: "too many hex digits", input: "e88a00", wantErr: true},
+		{name: "unknown name", input: "not_an_icon", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveCodePoint(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error: %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %U, want %U", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadedMaterialSymbolsFontParams(t *testing.T) {
+	tests := []struct {
+		name      string
+		loaded    []string
+		preferred MaterialSymbolsFontParams
+		want      string
+		wantOk    bool
+	}{
+		{
+			name:      "none loaded",
+			preferred: MaterialSymbolsFontParams{Style: "Rounded"},
+		},
+		{
+			name:      "preferred loaded",
+			loaded:    []string{"Outlined-24-400-0-0", "Rounded-48-400-0-0"},
+			preferred: MaterialSymbolsFontParams{Style: "Rounded"},
+			want:      "Rounded-48-400-0-0",
+			wantOk:    true,
+		},
+		{
+			name:      "another loaded",
+			loaded:    []string{"Sharp-20-100-1--25", "Sharp-24-400-0-0"},
+			preferred: MaterialSymbolsFontParams{Style: "Rounded"},
+			want:      "Sharp-20-100-1--25",
+			wantOk:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFontSources(t, nil)
+			for _, key := range tt.loaded {
+				materialSymbolsFamilies.Set(key, canvas.NewFontFamily("Material Symbols"))
+			}
+
+			got, ok := LoadedMaterialSymbolsFontParams(tt.preferred)
+			if ok != tt.wantOk {
+				t.Fatalf("got ok %v, want %v", ok, tt.wantOk)
+			}
+			if ok && got.String() != tt.want {
+				t.Errorf("got params %v, want %v", got.String(), tt.want)
+			}
+		})
+	}
+}
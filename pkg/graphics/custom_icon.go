@@ -0,0 +1,201 @@
+package graphics
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	_ "image/png"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"github.com/fufuok/cmap"
+	"github.com/tdewolff/canvas"
+	"github.com/tdewolff/canvas/renderers/rasterizer"
+	"github.com/tdewolff/canvas/renderers/svg"
+)
+
+// CustomIcon is a user image shown instead of a Material Symbols glyph. It is
+// rendered with the same layout, border and background as the glyphs, so the
+// Render methods mirror those of MaterialSymbolsFontParams.
+type CustomIcon struct {
+	File string // PNG, JPEG or SVG file
+	SVG  string // inline SVG, used when File is empty
+}
+
+// loadedIcons keeps the icon files read so far, so that a render does not read
+// and decode the file again unless it has changed.
+var loadedIcons = cmap.NewOf[string, loadedIcon]() // key: file path
+
+type loadedIcon struct {
+	size    int64
+	modTime time.Time
+	vector  *canvas.Canvas
+	raster  image.Image
+}
+
+// IsSet reports whether the icon replaces the glyph.
+func (ci *CustomIcon) IsSet() bool {
+	return ci.File != "" || strings.TrimSpace(ci.SVG) != ""
+}
+
+// load returns the icon as a vector canvas for SVG, or as an image otherwise.
+func (ci *CustomIcon) load() (*canvas.Canvas, image.Image, error) {
+	if ci.File == "" {
+		c, err := canvas.ParseSVG(strings.NewReader(ci.SVG))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid inline svg: %w", err)
+		}
+		return c, nil, nil
+	}
+
+	fi, err := os.Stat(ci.File)
+	if err != nil {
+		loadedIcons.Remove(ci.File)
+		return nil, nil, err
+	}
+	if l, ok := loadedIcons.Get(ci.File); ok && l.size == fi.Size() && l.modTime.Equal(fi.ModTime()) {
+		return l.vector, l.raster, nil
+	}
+
+	data, err := os.ReadFile(ci.File)
+	if err != nil {
+		return nil, nil, err
+	}
+	l := loadedIcon{size: fi.Size(), modTime: fi.ModTime()}
+	if strings.EqualFold(filepath.Ext(ci.File), ".svg") {
+		l.vector, err = canvas.ParseSVG(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid svg file '%v': %w", ci.File, err)
+		}
+	} else {
+		l.raster, _, err = image.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid image file '%v': %w", ci.File, err)
+		}
+	}
+	loadedIcons.Set(ci.File, l)
+	return l.vector, l.raster, nil
+}
+
+func (ci *CustomIcon) RenderIconCanvas(iconSize, imgSize, offsetX, offsetY int, borderColor, bgColor color.Color, borderWidth int) (*canvas.Canvas, error) {
+	vector, raster, err := ci.load()
+	if err != nil {
+		return nil, err
+	}
+
+	var w, h float64
+	if vector != nil {
+		w, h = vector.Size()
+	} else {
+		w, h = float64(raster.Bounds().Dx()), float64(raster.Bounds().Dy())
+	}
+	if w <= 0 || h <= 0 {
+		return nil, fmt.Errorf("icon has no size")
+	}
+
+	// fit the icon in the square a glyph takes, keeping the aspect ratio
+	iconSizeFloat := float64(iconSize)
+	scale := iconSizeFloat / math.Max(w, h)
+	x := float64(offsetX) + (iconSizeFloat-w*scale)/2
+	y := float64(offsetY) + (iconSizeFloat-h*scale)/2
+
+	imgSizeFloat := float64(imgSize)
+	c := canvas.New(imgSizeFloat, imgSizeFloat)
+	ctx := canvas.NewContext(c)
+
+	ctx.SetFillColor(bgColor)
+	ctx.DrawPath(0, 0, canvas.Rectangle(imgSizeFloat, imgSizeFloat))
+
+	// a raster image is resampled to the size it is drawn at, instead of
+	// embedding the whole file in every image sent to the Stream Deck
+	var fitted image.Image
+	if raster != nil {
+		fitted = imaging.Resize(raster, max(int(w*scale+0.5), 1), max(int(h*scale+0.5), 1), imaging.Lanczos)
+	}
+
+	if _, _, _, a := borderColor.RGBA(); borderWidth > 0 && a > 0 {
+		shape := fitted
+		if vector != nil {
+			shape = rasterizer.Draw(vector, canvas.DPMM(scale), canvas.DefaultColorSpace)
+		}
+		border := outline(shape, borderColor, borderWidth)
+		ctx.DrawImage(x-float64(borderWidth), y-float64(borderWidth), border, canvas.DPMM(1.0))
+	}
+
+	if vector != nil {
+		vector.RenderViewTo(c, canvas.Identity.Translate(x, y).Scale(scale, scale))
+	} else {
+		ctx.DrawImage(x, y, fitted, canvas.DPMM(1.0))
+	}
+
+	return c, nil
+}
+
+func (ci *CustomIcon) RenderIcon(iconSize, imgSize, offsetX, offsetY int, borderColor, bgColor color.Color, borderWidth int) (*image.RGBA, error) {
+	c, err := ci.RenderIconCanvas(iconSize, imgSize, offsetX, offsetY, borderColor, bgColor, borderWidth)
+	if err != nil {
+		return nil, err
+	}
+	return rasterizer.Draw(c, canvas.DPMM(1.0), canvas.DefaultColorSpace), nil
+}
+
+func (ci *CustomIcon) RenderIconSVG(iconSize, imgSize, offsetX, offsetY int, borderColor, bgColor color.Color, borderWidth int) (string, error) {
+	c, err := ci.RenderIconCanvas(iconSize, imgSize, offsetX, offsetY, borderColor, bgColor, borderWidth)
+	if err != nil {
+		return "", err
+	}
+
+	buf := new(bytes.Buffer)
+	svgRenderer := svg.New(buf, float64(imgSize), float64(imgSize), &svg.DefaultOptions)
+	c.RenderTo(svgRenderer)
+	svgRenderer.Close()
+
+	return buf.String(), nil
+}
+
+// outline returns the shape of img grown by width pixels and filled with c,
+// to be drawn under img as the border the glyphs get from their stroke. The
+// result is larger than img by width on every side.
+func outline(img image.Image, c color.Color, width int) *image.RGBA {
+	b := img.Bounds()
+	out := image.NewRGBA(image.Rect(0, 0, b.Dx()+2*width, b.Dy()+2*width))
+	cr, cg, cb, ca := c.RGBA()
+
+	for y := 0; y < out.Rect.Dy(); y++ {
+		for x := 0; x < out.Rect.Dx(); x++ {
+			// the highest alpha within the width around the pixel
+			var alpha uint32
+			for dy := -width; dy <= width && alpha < 0xffff; dy++ {
+				for dx := -width; dx <= width; dx++ {
+					if dx*dx+dy*dy > width*width {
+						continue
+					}
+					sx, sy := x-width+dx, y-width+dy
+					if sx < 0 || sy < 0 || sx >= b.Dx() || sy >= b.Dy() {
+						continue
+					}
+					if _, _, _, a := img.At(b.Min.X+sx, b.Min.Y+sy).RGBA(); a > alpha {
+						alpha = a
+					}
+				}
+			}
+			if alpha == 0 {
+				continue
+			}
+			// premultiplied by the alpha of both the color and the shape
+			out.Set(x, y, color.RGBA64{
+				R: uint16(cr * alpha / 0xffff),
+				G: uint16(cg * alpha / 0xffff),
+				B: uint16(cb * alpha / 0xffff),
+				A: uint16(ca * alpha / 0xffff),
+			})
+		}
+	}
+	return out
+}
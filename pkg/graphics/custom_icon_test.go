@@ -0,0 +1,100 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writePNG writes a square PNG of the size to path. The green channel is
+// noise, so that the file does not compress away.
+func writePNG(t *testing.T, path string, size int) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			img.Set(x, y, color.RGBA{0xff, uint8(x*31 ^ y*17 ^ x*y), 0, 0xff})
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCustomIconRaster(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "icon.png")
+	writePNG(t, path, 1024)
+	ci := CustomIcon{File: path}
+
+	tests := []struct {
+		name        string
+		borderWidth int
+	}{
+		{"without border", 0},
+		{"with border", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svg, err := ci.RenderIconSVG(36, 72, 18, 18, color.White, color.Black, tt.borderWidth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the image is embedded at the drawn size, not at 1024x1024
+			if len(svg) > 16*1024 {
+				t.Errorf("got %d bytes of svg, want the icon downscaled", len(svg))
+			}
+
+			img, err := ci.RenderIcon(36, 72, 18, 18, color.White, color.Black, tt.borderWidth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := color.RGBAModel.Convert(img.At(36, 36)).(color.RGBA); got.R != 0xff || got.B != 0 {
+				t.Errorf("got %v at the center, want the icon", got)
+			}
+		})
+	}
+}
+
+func TestCustomIconCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "icon.png")
+	writePNG(t, path, 64)
+	ci := CustomIcon{File: path}
+
+	_, first, err := ci.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, second, err := ci.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first != second {
+		t.Error("the unchanged file was decoded again")
+	}
+
+	// a changed file is read again
+	writePNG(t, path, 32)
+	_, third, err := ci.load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if third.Bounds().Dx() != 32 {
+		t.Errorf("got width %d, want the changed file", third.Bounds().Dx())
+	}
+
+	// a removed file is an error, not the cached image
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := ci.load(); err == nil {
+		t.Error("got no error for a removed file")
+	}
+}
@@ -0,0 +1,92 @@
+package graphics
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/fogleman/gg"
+)
+
+// ErrorOverlay draws a warning sign over a short message. It does not use
+// the icon font, so it also works when the font cannot be loaded.
+type ErrorOverlay struct {
+	Width, Height int
+	Background    color.Color
+	SignColor     color.Color
+	TextColor     color.Color
+	FontSize      float64
+	MaxLines      int
+}
+
+func NewErrorOverlay() *ErrorOverlay {
+	return &ErrorOverlay{
+		Width:      72,
+		Height:     72,
+		Background: color.RGBA{0x3d, 0x0c, 0x0c, 0xff},
+		SignColor:  color.RGBA{0xff, 0xc1, 0x07, 0xff},
+		TextColor:  color.White,
+		FontSize:   10,
+		MaxLines:   3,
+	}
+}
+
+// Render draws the sign, and the message below it if there is one.
+func (o *ErrorOverlay) Render(message string) (image.Image, error) {
+	c := gg.NewContext(o.Width, o.Height)
+	w := float64(o.Width)
+	h := float64(o.Height)
+
+	c.SetColor(o.Background)
+	c.Clear()
+
+	signSize := min(w, h) * 0.6
+	signTop := (h - signSize) / 2
+	if message != "" {
+		signSize = min(w, h) * 0.35
+		signTop = h * 0.08
+	}
+	cx := w / 2
+
+	// triangle
+	c.SetColor(o.SignColor)
+	c.MoveTo(cx, signTop)
+	c.LineTo(cx+signSize/2, signTop+signSize*0.87)
+	c.LineTo(cx-signSize/2, signTop+signSize*0.87)
+	c.ClosePath()
+	c.Fill()
+
+	// exclamation mark
+	c.SetColor(o.Background)
+	c.SetLineWidth(signSize * 0.1)
+	c.SetLineCap(gg.LineCapRound)
+	c.DrawLine(cx, signTop+signSize*0.3, cx, signTop+signSize*0.58)
+	c.Stroke()
+	c.DrawCircle(cx, signTop+signSize*0.72, signSize*0.05)
+	c.Fill()
+
+	if message == "" {
+		return c.Image(), nil
+	}
+
+	face, err := labelFace(o.FontSize)
+	if err != nil {
+		return nil, err
+	}
+	c.SetFontFace(face)
+	c.SetColor(o.TextColor)
+
+	margin := w * 0.06
+	lines := c.WordWrap(message, w-2*margin)
+	if len(lines) > o.MaxLines {
+		lines = lines[:o.MaxLines]
+		lines[o.MaxLines-1] += "…"
+	}
+	lineHeight := o.FontSize * 1.15
+	y := signTop + signSize*0.87 + h*0.06
+	for _, line := range lines {
+		c.DrawStringAnchored(line, cx, y, 0.5, 1)
+		y += lineHeight
+	}
+
+	return c.Image(), nil
+}
@@ -0,0 +1,258 @@
+package graphics
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The font cache keeps fonts fetched from the remote source on disk, one
+// file per variant:
+//
+//	<cache dir>/materialSymbols/<Style-Opsz-Wght-Fill-Grad>.<sha256 prefix>.woff2
+//
+// The hash in the name is checked on read, and a file that does not match is
+// removed. Files are written to a temporary file and renamed, so a reader
+// never sees a partial file. When the files exceed the size limit, the least
+// recently used ones are removed.
+
+const (
+	fontCacheDirName     = "materialSymbols"
+	fontCacheExt         = ".woff2"
+	fontCacheHashLen     = 16 // hex digits of sha256 in the file name
+	legacyFontsCacheName = "materialSymbolsCache.json"
+)
+
+var (
+	fontCacheMu      sync.Mutex // guards the files in the cache dir
+	fontCacheMaxSize int64      = 64 << 20
+	migrateOnce      sync.Once
+
+	fetchMu  sync.Mutex
+	fetching = map[string]*fontFetch{} // key: params.String()
+)
+
+type fontFetch struct {
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// SetMaterialSymbolsCacheMaxSize sets the size limit of the font cache in
+// bytes. The default is 64 MiB. Zero or less disables the limit.
+func SetMaterialSymbolsCacheMaxSize(size int64) {
+	fontCacheMu.Lock()
+	defer fontCacheMu.Unlock()
+	fontCacheMaxSize = size
+}
+
+// fetchOnce runs fetch once for concurrent callers with the same key; the
+// others wait for its result.
+func fetchOnce(key string, fetch func() ([]byte, error)) ([]byte, error) {
+	fetchMu.Lock()
+	if f, ok := fetching[key]; ok {
+		fetchMu.Unlock()
+		<-f.done
+		return f.data, f.err
+	}
+	f := &fontFetch{done: make(chan struct{})}
+	fetching[key] = f
+	fetchMu.Unlock()
+
+	f.data, f.err = fetch()
+
+	fetchMu.Lock()
+	delete(fetching, key)
+	fetchMu.Unlock()
+	close(f.done)
+	return f.data, f.err
+}
+
+func fontCacheDir() string {
+	return filepath.Join(getCacheDir(), fontCacheDirName)
+}
+
+func fontHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:fontCacheHashLen]
+}
+
+// readCachedFont returns the cached font for the key, or fs.ErrNotExist.
+func readCachedFont(key string) ([]byte, error) {
+	migrateOnce.Do(migrateLegacyFontsCache)
+
+	fontCacheMu.Lock()
+	defer fontCacheMu.Unlock()
+
+	dir := fontCacheDir()
+	paths, err := filepath.Glob(filepath.Join(dir, key+".*"+fontCacheExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range paths {
+		hash := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), key+"."), fontCacheExt)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if fontHash(data) != hash {
+			// broken file; fetch again
+			os.Remove(path)
+			continue
+		}
+		now := time.Now()
+		os.Chtimes(path, now, now) // mark as recently used
+		return data, nil
+	}
+	return nil, fs.ErrNotExist
+}
+
+// removeCachedFont removes the cached font for the key.
+func removeCachedFont(key string) error {
+	fontCacheMu.Lock()
+	defer fontCacheMu.Unlock()
+	return removeFontFiles(fontCacheDir(), key, "")
+}
+
+// removeFontFiles removes the files of the key in dir, except the one named
+// keep. Must be called with fontCacheMu held.
+func removeFontFiles(dir, key, keep string) error {
+	paths, err := filepath.Glob(filepath.Join(dir, key+".*"+fontCacheExt))
+	if err != nil {
+		return err
+	}
+	for _, path := range paths {
+		if filepath.Base(path) == keep {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeCachedFont stores the font for the key and evicts old fonts over the
+// size limit.
+func writeCachedFont(key string, data []byte) error {
+	fontCacheMu.Lock()
+	defer fontCacheMu.Unlock()
+
+	dir := fontCacheDir()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	name := key + "." + fontHash(data) + fontCacheExt
+	if err := writeFileAtomic(filepath.Join(dir, name), data); err != nil {
+		return err
+	}
+	// a font replaced by the remote source leaves no older file to be read
+	if err := removeFontFiles(dir, key, name); err != nil {
+		return err
+	}
+	return evictFonts(dir, name)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// evictFonts removes the least recently used fonts until the cache fits the
+// size limit. The file named keep is never removed. Must be called with
+// fontCacheMu held.
+func evictFonts(dir, keep string) error {
+	if fontCacheMaxSize <= 0 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	type cachedFont struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	fonts := []cachedFont{}
+	total := int64(0)
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), fontCacheExt) {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+		fonts = append(fonts, cachedFont{entry.Name(), info.Size(), info.ModTime()})
+		total += info.Size()
+	}
+	slices.SortFunc(fonts, func(a, b cachedFont) int {
+		return a.modTime.Compare(b.modTime)
+	})
+	for _, f := range fonts {
+		if total <= fontCacheMaxSize {
+			break
+		}
+		if f.name == keep {
+			continue
+		}
+		if err := os.Remove(filepath.Join(dir, f.name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		total -= f.size
+	}
+	return nil
+}
+
+// migrateLegacyFontsCache moves the fonts of the single json file used by
+// earlier versions into the cache dir.
+func migrateLegacyFontsCache() {
+	path := filepath.Join(getCacheDir(), legacyFontsCacheName)
+	if !isFileExist(path) {
+		return
+	}
+	defer os.Remove(path)
+
+	fontsCacheJson, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	fonts := map[string][]byte{}
+	if err := json.Unmarshal(fontsCacheJson, &fonts); err != nil {
+		return
+	}
+	for key, data := range fonts {
+		if err := parseFont(data); err != nil {
+			log.Printf("error parsing cached font %v: %v\n", key, err)
+			continue
+		}
+		if err := writeCachedFont(key, data); err != nil {
+			log.Printf("error migrating cached font %v: %v\n", key, err)
+		}
+	}
+}
@@ -0,0 +1,357 @@
+package graphics
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const cachedFontKey = "Outlined-24-400-0-0"
+
+// cachedFontNames returns the names of the files in the cache dir.
+func cachedFontNames(t *testing.T) []string {
+	t.Helper()
+	entries, err := os.ReadDir(fontCacheDir())
+	if errors.Is(err, fs.ErrNotExist) {
+		return []string{}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	return names
+}
+
+func cachedFontName(key string, data []byte) string {
+	return key + "." + fontHash(data) + fontCacheExt
+}
+
+func TestWriteCachedFont(t *testing.T) {
+	tests := []struct {
+		name   string
+		writes [][]byte
+	}{
+		{"new font", [][]byte{[]byte("a")}},
+		{"replaced font", [][]byte{[]byte("a"), []byte("b")}},
+		{"same font again", [][]byte{[]byte("a"), []byte("a")}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFontSources(t, nil)
+
+			for _, data := range tt.writes {
+				if err := writeCachedFont(cachedFontKey, data); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// one file named after the last font, and no temporary files
+			last := tt.writes[len(tt.writes)-1]
+			if got, want := cachedFontNames(t), []string{cachedFontName(cachedFontKey, last)}; !slices.Equal(got, want) {
+				t.Errorf("got files %v, want %v", got, want)
+			}
+			got, err := readCachedFont(cachedFontKey)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, last) {
+				t.Errorf("got font %q, want %q", got, last)
+			}
+		})
+	}
+}
+
+func TestReadCachedFontIntegrity(t *testing.T) {
+	tests := []struct {
+		name    string
+		corrupt func(path string) error
+		wantErr error
+	}{
+		{
+			name:    "intact",
+			corrupt: func(path string) error { return nil },
+		},
+		{
+			name:    "changed",
+			corrupt: func(path string) error { return os.WriteFile(path, []byte("changed"), 0644) },
+			wantErr: fs.ErrNotExist,
+		},
+		{
+			name:    "truncated",
+			corrupt: func(path string) error { return os.Truncate(path, 1) },
+			wantErr: fs.ErrNotExist,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFontSources(t, nil)
+			data := []byte("font")
+			if err := writeCachedFont(cachedFontKey, data); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.corrupt(filepath.Join(fontCacheDir(), cachedFontName(cachedFontKey, data))); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := readCachedFont(cachedFontKey)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				// the broken file is removed, so that the font is fetched again
+				if names := cachedFontNames(t); len(names) != 0 {
+					t.Errorf("got files %v, want none", names)
+				}
+				return
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("got font %q, want %q", got, data)
+			}
+		})
+	}
+}
+
+func TestEvictFonts(t *testing.T) {
+	const (
+		opsz20 = "Outlined-20-400-0-0"
+		opsz24 = "Outlined-24-400-0-0"
+		opsz40 = "Outlined-40-400-0-0"
+	)
+	tests := []struct {
+		name    string
+		maxSize int64
+		cached  []string // written in order before; each font is 4 bytes
+		used    []string // read in order after
+		write   string   // the font written last
+		want    []string
+	}{
+		{
+			name:    "under the limit",
+			maxSize: 12,
+			cached:  []string{opsz20, opsz24},
+			write:   opsz40,
+			want:    []string{opsz20, opsz24, opsz40},
+		},
+		{
+			name:    "oldest removed first",
+			maxSize: 8,
+			cached:  []string{opsz20, opsz24},
+			write:   opsz40,
+			want:    []string{opsz24, opsz40},
+		},
+		{
+			name:    "recently read kept",
+			maxSize: 8,
+			cached:  []string{opsz20, opsz24},
+			used:    []string{opsz20},
+			write:   opsz40,
+			want:    []string{opsz20, opsz40},
+		},
+		{
+			name:    "new font kept over the limit",
+			maxSize: 2,
+			cached:  []string{opsz20},
+			write:   opsz24,
+			want:    []string{opsz24},
+		},
+		{
+			name:    "no limit",
+			maxSize: 0,
+			cached:  []string{opsz20, opsz24},
+			write:   opsz40,
+			want:    []string{opsz20, opsz24, opsz40},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFontSources(t, nil)
+			SetMaterialSymbolsCacheMaxSize(tt.maxSize)
+			t.Cleanup(func() { SetMaterialSymbolsCacheMaxSize(64 << 20) })
+
+			data := func(key string) []byte { return []byte(key[len(key)-4:]) }
+			// the fonts are ordered by their modification time, which is set
+			// apart explicitly since the writes may share a timestamp
+			clock := time.Now().Add(-time.Hour)
+			touch := func(key string) {
+				t.Helper()
+				clock = clock.Add(time.Minute)
+				path := filepath.Join(fontCacheDir(), cachedFontName(key, data(key)))
+				if err := os.Chtimes(path, clock, clock); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			for _, key := range tt.cached {
+				if err := writeCachedFont(key, data(key)); err != nil {
+					t.Fatal(err)
+				}
+				touch(key)
+			}
+			for _, key := range tt.used {
+				if _, err := readCachedFont(key); err != nil {
+					t.Fatal(err)
+				}
+				touch(key)
+			}
+			if err := writeCachedFont(tt.write, data(tt.write)); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{}
+			for _, key := range tt.want {
+				want = append(want, cachedFontName(key, data(key)))
+			}
+			if got := cachedFontNames(t); !slices.Equal(got, want) {
+				t.Errorf("got files %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestMigrateLegacyFontsCache(t *testing.T) {
+	setFontSources(t, nil)
+	migrateOnce = sync.Once{}
+	t.Cleanup(func() { migrateOnce = sync.Once{} })
+
+	font := fixtureFont(t)
+	legacy, err := json.Marshal(map[string][]byte{
+		cachedFontKey:        font,
+		"Rounded-24-400-0-0": []byte("not a font"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyPath := filepath.Join(getCacheDir(), legacyFontsCacheName)
+	if err := os.WriteFile(legacyPath, legacy, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := readCachedFont(cachedFontKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, font) {
+		t.Error("got a font other than the migrated one")
+	}
+	if _, err := readCachedFont("Rounded-24-400-0-0"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("got error %v for the font that does not parse, want %v", err, fs.ErrNotExist)
+	}
+	if isFileExist(legacyPath) {
+		t.Error("the legacy file was not removed")
+	}
+}
+
+func TestMaterialSymbolsFontUnparsable(t *testing.T) {
+	font := fixtureFont(t)
+	garbage := []byte("<html>rate limited</html>")
+
+	tests := []struct {
+		name      string
+		cached    []byte
+		remote    []byte
+		wantFont  bool
+		wantFiles []string
+	}{
+		{
+			name:      "cached font that does not parse is fetched again",
+			cached:    garbage,
+			remote:    font,
+			wantFont:  true,
+			wantFiles: []string{cachedFontName(cachedFontKey, font)},
+		},
+		{
+			name:      "remote font that does not parse is not cached",
+			remote:    garbage,
+			wantFiles: []string{},
+		},
+		{
+			name:      "both do not parse",
+			cached:    garbage,
+			remote:    garbage,
+			wantFiles: []string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remote := fontSourceFunc(func(p *MaterialSymbolsFontParams) ([]byte, error) {
+				return tt.remote, nil
+			})
+			setFontSources(t, remote)
+			if tt.cached != nil {
+				if err := writeCachedFont(cachedFontKey, tt.cached); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			got, err := newFontParams("Outlined", "24", "400").getFont()
+			if tt.wantFont {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(got, font) {
+					t.Error("got a font other than the remote one")
+				}
+			} else if err == nil {
+				t.Error("got no error")
+			}
+			if names := cachedFontNames(t); !slices.Equal(names, tt.wantFiles) {
+				t.Errorf("got files %v, want %v", names, tt.wantFiles)
+			}
+		})
+	}
+}
+
+func TestMaterialSymbolsFontConcurrentFirstUse(t *testing.T) {
+	font := fixtureFont(t)
+	release := make(chan struct{})
+	var remoteCalls atomic.Int32
+	remote := fontSourceFunc(func(p *MaterialSymbolsFontParams) ([]byte, error) {
+		remoteCalls.Add(1)
+		<-release
+		return font, nil
+	})
+	setFontSources(t, remote)
+
+	const callers = 16
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := newFontParams("Outlined", "24", "400").getFont()
+			if err == nil && !bytes.Equal(got, font) {
+				err = errors.New("got a font other than the remote one")
+			}
+			errs <- err
+		}()
+	}
+	// let the callers pile up on the first fetch
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if n := remoteCalls.Load(); n != 1 {
+		t.Errorf("remote called %d times, want 1", n)
+	}
+	if names := cachedFontNames(t); len(names) != 1 {
+		t.Errorf("got files %v, want one", names)
+	}
+}
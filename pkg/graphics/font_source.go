@@ -0,0 +1,128 @@
+package graphics
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/fufuok/cmap"
+)
+
+// ErrFontNotFound is returned by a FontSource that has no font for the params.
+var ErrFontNotFound = errors.New("font not found")
+
+// FontSource provides Material Symbols font files.
+type FontSource interface {
+	// Font returns the font file for the params, or ErrFontNotFound.
+	Font(p *MaterialSymbolsFontParams) ([]byte, error)
+}
+
+// FontDir is a directory of Material Symbols font files. A font is looked up
+// by the name of the variant first, then by the name of the style:
+//
+//	MaterialSymbolsRounded-48-400-0-0.woff2 // Style-Opsz-Wght-Fill-Grad
+//	MaterialSymbolsRounded[FILL,GRAD,opsz,wght].ttf
+//	MaterialSymbolsRounded.ttf
+//
+// The extension may be .woff2, .woff, .ttf or .otf. Variable fonts are not
+// instanced and draw at their default axes, so a style file is only used for
+// params at the default axes; other variants are left to the next source.
+type FontDir string
+
+func (d FontDir) Font(p *MaterialSymbolsFontParams) ([]byte, error) {
+	if d == "" {
+		return nil, ErrFontNotFound
+	}
+	names := []string{"MaterialSymbols" + p.String()}
+	if p.isDefaultAxes() {
+		names = append(names,
+			"MaterialSymbols"+p.Style+"[FILL,GRAD,opsz,wght]",
+			"MaterialSymbols"+p.Style,
+		)
+	}
+	for _, name := range names {
+		for _, ext := range []string{".woff2", ".woff", ".ttf", ".otf"} {
+			path := filepath.Join(string(d), name+ext)
+			if !isFileExist(path) {
+				continue
+			}
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return nil, err
+			}
+			return data, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %v in %v", ErrFontNotFound, p.String(), string(d))
+}
+
+// GoogleFonts fetches fonts from Google Fonts.
+type GoogleFonts struct{}
+
+func (GoogleFonts) Font(p *MaterialSymbolsFontParams) ([]byte, error) {
+	return p.fetchWoff2()
+}
+
+var (
+	fontSourcesMu sync.RWMutex
+	localSources  []FontSource
+	remoteSource  FontSource = GoogleFonts{}
+	localFonts               = cmap.NewOf[string, []byte]() // key: params.String()
+)
+
+// SetMaterialSymbolsFontSources sets the sources looked up, in order, before
+// the cache and the remote source. Fonts found in them are not cached on disk.
+func SetMaterialSymbolsFontSources(sources ...FontSource) {
+	fontSourcesMu.Lock()
+	localSources = sources
+	localFonts.Clear()
+	fontSourcesMu.Unlock()
+
+	resetFontCaches()
+	resetCodepoints()
+}
+
+// SetMaterialSymbolsRemoteSource sets the source used when neither the local
+// sources nor the cache have the font. The default is GoogleFonts; nil
+// disables the fetch.
+func SetMaterialSymbolsRemoteSource(source FontSource) {
+	fontSourcesMu.Lock()
+	defer fontSourcesMu.Unlock()
+	remoteSource = source
+	resetFontCaches()
+}
+
+func getLocalFont(p *MaterialSymbolsFontParams) ([]byte, error) {
+	fontSourcesMu.RLock()
+	defer fontSourcesMu.RUnlock()
+
+	key := p.String()
+	if data, ok := localFonts.Get(key); ok {
+		return data, nil
+	}
+	for _, source := range localSources {
+		data, err := source.Font(p)
+		if errors.Is(err, ErrFontNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		localFonts.Set(key, data)
+		return data, nil
+	}
+	return nil, ErrFontNotFound
+}
+
+func getRemoteFont(p *MaterialSymbolsFontParams) ([]byte, error) {
+	fontSourcesMu.RLock()
+	source := remoteSource
+	fontSourcesMu.RUnlock()
+
+	if source == nil {
+		return nil, fmt.Errorf("%w: %v, and fetching is disabled", ErrFontNotFound, p.String())
+	}
+	return source.Font(p)
+}
@@ -0,0 +1,281 @@
+package graphics
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixtureFontDir has the fixture font, a few icons drawn as simple shapes
+// under the name of the Outlined style; see testdata/genfont.
+const fixtureFontDir = FontDir("testdata")
+
+// fixtureFont returns the font file of fixtureFontDir. The remote source must
+// return a real font, since fonts that do not parse are not cached.
+func fixtureFont(tb testing.TB) []byte {
+	tb.Helper()
+	data, err := os.ReadFile(filepath.Join(string(fixtureFontDir), "MaterialSymbolsOutlined.ttf"))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return data
+}
+
+// fontSourceFunc is a FontSource calling the function.
+type fontSourceFunc func(p *MaterialSymbolsFontParams) ([]byte, error)
+
+func (f fontSourceFunc) Font(p *MaterialSymbolsFontParams) ([]byte, error) {
+	return f(p)
+}
+
+// setFontSources replaces the font sources and the font cache until the test
+// ends.
+func setFontSources(tb testing.TB, remote FontSource, local ...FontSource) {
+	tb.Helper()
+	SetMaterialSymbolsCacheDir(tb.TempDir())
+	SetMaterialSymbolsFontSources(local...)
+	SetMaterialSymbolsRemoteSource(remote)
+	materialSymbolsFonts.Clear()
+	tb.Cleanup(func() {
+		SetMaterialSymbolsFontSources()
+		SetMaterialSymbolsRemoteSource(GoogleFonts{})
+		SetMaterialSymbolsCacheDir("")
+		materialSymbolsFonts.Clear()
+	})
+}
+
+// newFontDir writes the files, keyed by name, to a new directory.
+func newFontDir(t *testing.T, files map[string]string) FontDir {
+	t.Helper()
+	dir := t.TempDir()
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return FontDir(dir)
+}
+
+func newFontParams(style, opsz, wght string) *MaterialSymbolsFontParams {
+	p := &MaterialSymbolsFontParams{Style: style, Opsz: opsz, Wght: wght}
+	p.FillEmptyWithDefault()
+	return p
+}
+
+func TestMaterialSymbolsFontSourceOrder(t *testing.T) {
+	const variant = "MaterialSymbolsOutlined-24-400-0-0.ttf"
+	const style = "MaterialSymbolsOutlined.ttf"
+
+	tests := []struct {
+		name       string
+		user       map[string]string
+		shipped    map[string]string
+		want       string
+		wantRemote int
+	}{
+		{
+			name:    "user dir first",
+			user:    map[string]string{variant: "user"},
+			shipped: map[string]string{variant: "shipped"},
+			want:    "user",
+		},
+		{
+			name:    "style file of user dir before variant file of shipped dir",
+			user:    map[string]string{style: "user"},
+			shipped: map[string]string{variant: "shipped"},
+			want:    "user",
+		},
+		{
+			name:    "shipped dir when user dir has none",
+			shipped: map[string]string{variant: "shipped"},
+			want:    "shipped",
+		},
+		{
+			name:       "remote when no dir has it",
+			want:       "remote",
+			wantRemote: 1,
+		},
+	}
+	remoteFont := fixtureFont(t)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			remoteCalls := 0
+			remote := fontSourceFunc(func(p *MaterialSymbolsFontParams) ([]byte, error) {
+				remoteCalls++
+				return remoteFont, nil
+			})
+			setFontSources(t, remote, newFontDir(t, tt.user), newFontDir(t, tt.shipped))
+
+			got, err := newFontParams("Outlined", "24", "400").getFont()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(got, remoteFont) {
+				got = []byte("remote")
+			}
+			if string(got) != tt.want {
+				t.Errorf("got font %q, want %q", got, tt.want)
+			}
+			if remoteCalls != tt.wantRemote {
+				t.Errorf("remote called %d times, want %d", remoteCalls, tt.wantRemote)
+			}
+		})
+	}
+}
+
+func TestMaterialSymbolsFontCachedBeforeRemote(t *testing.T) {
+	remoteFont := fixtureFont(t)
+	remoteCalls := 0
+	remote := fontSourceFunc(func(p *MaterialSymbolsFontParams) ([]byte, error) {
+		remoteCalls++
+		return remoteFont, nil
+	})
+	setFontSources(t, remote)
+
+	p := newFontParams("Rounded", "24", "300")
+	if _, err := p.getFont(); err != nil {
+		t.Fatal(err)
+	}
+	// as after a restart of the plugin
+	materialSymbolsFonts.Clear()
+	got, err := p.getFont()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, remoteFont) {
+		t.Error("got a font other than the remote one")
+	}
+	if remoteCalls != 1 {
+		t.Errorf("remote called %d times, want 1", remoteCalls)
+	}
+}
+
+func TestMaterialSymbolsFontNotFound(t *testing.T) {
+	errBroken := errors.New("broken")
+	notFound := fontSourceFunc(func(p *MaterialSymbolsFontParams) ([]byte, error) {
+		return nil, ErrFontNotFound
+	})
+	broken := fontSourceFunc(func(p *MaterialSymbolsFontParams) ([]byte, error) {
+		return nil, errBroken
+	})
+	found := fontSourceFunc(func(p *MaterialSymbolsFontParams) ([]byte, error) {
+		return []byte("found"), nil
+	})
+
+	tests := []struct {
+		name    string
+		remote  FontSource
+		local   []FontSource
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "not found falls through to the next source",
+			remote: broken,
+			local:  []FontSource{notFound, FontDir(""), FontDir(filepath.Join(t.TempDir(), "missing")), found},
+			want:   "found",
+		},
+		{
+			name:    "other errors stop the lookup",
+			remote:  found,
+			local:   []FontSource{broken, found},
+			wantErr: errBroken,
+		},
+		{
+			name:    "remote disabled",
+			local:   []FontSource{notFound},
+			wantErr: ErrFontNotFound,
+		},
+		{
+			name:    "remote failed",
+			remote:  broken,
+			local:   []FontSource{notFound},
+			wantErr: errBroken,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setFontSources(t, tt.remote, tt.local...)
+
+			got, err := newFontParams("Outlined", "48", "400").getFont()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got font %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFontDirNames(t *testing.T) {
+	dir := newFontDir(t, map[string]string{
+		"MaterialSymbolsRounded-48-400-0-0.woff2":         "variant",
+		"MaterialSymbolsRounded[FILL,GRAD,opsz,wght].ttf": "variable",
+		"MaterialSymbolsSharp.ttf":                        "static ttf",
+		"MaterialSymbolsSharp.woff2":                      "static woff2",
+	})
+
+	tests := []struct {
+		name    string
+		params  *MaterialSymbolsFontParams
+		want    string
+		wantErr error
+	}{
+		{
+			name:   "variant name",
+			params: newFontParams("Rounded", "48", "400"),
+			want:   "variant",
+		},
+		{
+			name:   "style name of variable font at the default axes",
+			params: newFontParams("Rounded", "24", "400"),
+			want:   "variable",
+		},
+		{
+			name:    "no style name for other axes",
+			params:  newFontParams("Rounded", "24", "700"),
+			wantErr: ErrFontNotFound,
+		},
+		{
+			name:   "style name, woff2 first",
+			params: newFontParams("Sharp", "24", "400"),
+			want:   "static woff2",
+		},
+		{
+			name:    "no static style file for other axes",
+			params:  newFontParams("Sharp", "20", "100"),
+			wantErr: ErrFontNotFound,
+		},
+		{
+			name:    "other style",
+			params:  newFontParams("Outlined", "48", "400"),
+			wantErr: ErrFontNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := dir.Font(tt.params)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got font %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFixtureFont(t *testing.T) {
+	setFontSources(t, nil, fixtureFontDir)
+
+	path, err := newFontParams("Outlined", "24", "400").GetIconPath("home", 24)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if path.Empty() {
+		t.Error("got an empty path for 'home'")
+	}
+}
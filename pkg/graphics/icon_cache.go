@@ -0,0 +1,154 @@
+package graphics
+
+import (
+	"container/list"
+	"image"
+	"image/color"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/fufuok/cmap"
+	"github.com/tdewolff/canvas"
+)
+
+// Parsing a font takes far longer than drawing a glyph, and the same icons are
+// drawn again on every WillAppear and settings change, so both the parsed
+// fonts and the rendered icons are kept in memory.
+
+const iconCacheSize = 256 // rendered icons
+
+var (
+	materialSymbolsFamilies = cmap.NewOf[string, *canvas.FontFamily]() // key: params.String()
+	renderedIcons           = newIconCache(iconCacheSize)
+)
+
+type iconKey struct {
+	svg         bool
+	params      string
+	codePoint   string
+	iconSize    int
+	imgSize     int
+	offsetX     int
+	offsetY     int
+	iconColor   color.RGBA64
+	borderColor color.RGBA64
+	bgColor     color.RGBA64
+	borderWidth int
+}
+
+func newIconKey(svg bool, p *MaterialSymbolsFontParams, codePoint string, iconSize, imgSize, offsetX, offsetY int, iconColor, borderColor, bgColor color.Color, borderWidth int) iconKey {
+	return iconKey{
+		svg:         svg,
+		params:      p.String(),
+		codePoint:   codePoint,
+		iconSize:    iconSize,
+		imgSize:     imgSize,
+		offsetX:     offsetX,
+		offsetY:     offsetY,
+		iconColor:   color.RGBA64Model.Convert(iconColor).(color.RGBA64),
+		borderColor: color.RGBA64Model.Convert(borderColor).(color.RGBA64),
+		bgColor:     color.RGBA64Model.Convert(bgColor).(color.RGBA64),
+		borderWidth: borderWidth,
+	}
+}
+
+// iconCache is a LRU cache of rendered icons. The values are *image.RGBA or
+// string (SVG).
+type iconCache struct {
+	mu    sync.Mutex
+	size  int
+	order *list.List // front: most recently used
+	items map[iconKey]*list.Element
+}
+
+type iconCacheEntry struct {
+	key   iconKey
+	value any
+}
+
+func newIconCache(size int) *iconCache {
+	return &iconCache{
+		size:  size,
+		order: list.New(),
+		items: map[iconKey]*list.Element{},
+	}
+}
+
+func (c *iconCache) get(key iconKey) (any, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*iconCacheEntry).value, true
+}
+
+func (c *iconCache) set(key iconKey, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok {
+		e.Value.(*iconCacheEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&iconCacheEntry{key, value})
+	for c.order.Len() > c.size {
+		e := c.order.Back()
+		c.order.Remove(e)
+		delete(c.items, e.Value.(*iconCacheEntry).key)
+	}
+}
+
+func (c *iconCache) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.order.Init()
+	clear(c.items)
+}
+
+// LoadedMaterialSymbolsFontParams returns the params of a font parsed so far,
+// preferring p, so that drawing with them does not wait for a font to be read
+// or fetched. It returns false if no font has been parsed yet.
+func LoadedMaterialSymbolsFontParams(p MaterialSymbolsFontParams) (MaterialSymbolsFontParams, bool) {
+	p.FillEmptyWithDefault()
+	if materialSymbolsFamilies.Has(p.String()) {
+		return p, true
+	}
+	keys := materialSymbolsFamilies.Keys()
+	if len(keys) == 0 {
+		return MaterialSymbolsFontParams{}, false
+	}
+	slices.Sort(keys)
+	// the key is params.String(); the grade may be negative, like "-25"
+	fields := strings.SplitN(keys[0], "-", 5)
+	if len(fields) != 5 {
+		return MaterialSymbolsFontParams{}, false
+	}
+	return MaterialSymbolsFontParams{
+		Style: fields[0],
+		Opsz:  fields[1],
+		Wght:  fields[2],
+		Fill:  fields[3],
+		Grad:  fields[4],
+	}, true
+}
+
+// resetFontCaches drops everything drawn with the fonts found so far. Called
+// when the font sources change.
+func resetFontCaches() {
+	materialSymbolsFamilies.Clear()
+	renderedIcons.clear()
+}
+
+func cloneRGBA(img *image.RGBA) *image.RGBA {
+	clone := &image.RGBA{
+		Pix:    make([]uint8, len(img.Pix)),
+		Stride: img.Stride,
+		Rect:   img.Rect,
+	}
+	copy(clone.Pix, img.Pix)
+	return clone
+}
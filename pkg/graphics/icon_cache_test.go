@@ -0,0 +1,125 @@
+package graphics
+
+import (
+	"image/color"
+	"slices"
+	"testing"
+)
+
+func iconCacheKeys(c *iconCache) []string {
+	keys := []string{}
+	for e := c.order.Front(); e != nil; e = e.Next() {
+		keys = append(keys, e.Value.(*iconCacheEntry).key.codePoint)
+	}
+	return keys
+}
+
+func TestIconCacheEviction(t *testing.T) {
+	key := func(codePoint string) iconKey {
+		return iconKey{codePoint: codePoint}
+	}
+	c := newIconCache(3)
+	c.set(key("a"), 1)
+	c.set(key("b"), 2)
+	c.set(key("c"), 3)
+
+	// a becomes the most recently used, so b is the oldest
+	if _, ok := c.get(key("a")); !ok {
+		t.Fatal("a is missing")
+	}
+	c.set(key("d"), 4)
+	if want := []string{"d", "a", "c"}; !slices.Equal(iconCacheKeys(c), want) {
+		t.Errorf("got order %v, want %v", iconCacheKeys(c), want)
+	}
+	if _, ok := c.get(key("b")); ok {
+		t.Error("b was not evicted")
+	}
+
+	// setting a cached key replaces the value without evicting
+	c.set(key("c"), 30)
+	if want := []string{"c", "d", "a"}; !slices.Equal(iconCacheKeys(c), want) {
+		t.Errorf("got order %v, want %v", iconCacheKeys(c), want)
+	}
+	if v, _ := c.get(key("c")); v != 30 {
+		t.Errorf("got value %v, want 30", v)
+	}
+	if len(c.items) != 3 {
+		t.Errorf("got %d items, want 3", len(c.items))
+	}
+
+	c.clear()
+	if c.order.Len() != 0 || len(c.items) != 0 {
+		t.Errorf("got %d entries after clear, want 0", c.order.Len())
+	}
+}
+
+func TestRenderIconCached(t *testing.T) {
+	setFontSources(t, nil, fixtureFontDir)
+	p := newFontParams("Outlined", "24", "400")
+
+	first, err := p.RenderIcon("home", 48, 72, 0, 0, color.White, color.Black, color.Black, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := cloneRGBA(first)
+	// the caller owns the image it gets
+	first.Set(36, 36, color.RGBA{R: 255, A: 255})
+
+	second, err := p.RenderIcon("home", 48, 72, 0, 0, color.White, color.Black, color.Black, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(second.Pix, want.Pix) {
+		t.Error("the cached icon was changed through an image returned before")
+	}
+}
+
+func benchmarkColdWarm(b *testing.B, reset func(), render func() error) {
+	setFontSources(b, nil, fixtureFontDir)
+
+	b.Run("cold", func(b *testing.B) {
+		for range b.N {
+			b.StopTimer()
+			reset()
+			b.StartTimer()
+			if err := render(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("warm", func(b *testing.B) {
+		if err := render(); err != nil {
+			b.Fatal(err)
+		}
+		b.ResetTimer()
+		for range b.N {
+			if err := render(); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkGetIconPath(b *testing.B) {
+	p := newFontParams("Outlined", "24", "400")
+	benchmarkColdWarm(b, materialSymbolsFamilies.Clear, func() error {
+		_, err := p.GetIconPath("home", 48)
+		return err
+	})
+}
+
+func BenchmarkRenderIconSVG(b *testing.B) {
+	p := newFontParams("Outlined", "24", "400")
+	benchmarkColdWarm(b, resetFontCaches, func() error {
+		_, err := p.RenderIconSVG("home", 48, 72, 0, 0, color.White, color.Black, color.Black, 2)
+		return err
+	})
+}
+
+func BenchmarkRenderIcon(b *testing.B) {
+	p := newFontParams("Outlined", "24", "400")
+	benchmarkColdWarm(b, resetFontCaches, func() error {
+		_, err := p.RenderIcon("home", 48, 72, 0, 0, color.White, color.Black, color.Black, 2)
+		return err
+	})
+}
@@ -2,16 +2,17 @@ package graphics
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"image"
 	"image/color"
 	"image/draw"
 	"io"
+	"io/fs"
+	"log"
 	"net/http"
 	"os"
-	"path/filepath"
 	"regexp"
-	"strconv"
 
 	"github.com/esimov/stackblur-go"
 	"github.com/fufuok/cmap"
@@ -21,7 +22,7 @@ import (
 )
 
 var (
-	materialSymbolsFonts    *cmap.MapOf[string, []byte] // key: params.String()
+	materialSymbolsFonts    = cmap.NewOf[string, []byte]() // key: params.String()
 	materialSymbolsCacheDir string
 )
 
@@ -35,29 +36,24 @@ type MaterialSymbolsFontParams struct {
 
 // SetMaterialSymbolsCacheDir set the cache directory for Material Symbols fonts.
 // If not set, the system temporary directory will be used.
-// The fonts cache file is named "materialSymbolsCache.json".
+// The fonts are cached in the "materialSymbols" subdirectory, one file per variant.
+// Only fonts from the remote source are cached; see SetMaterialSymbolsFontSources.
 func SetMaterialSymbolsCacheDir(dir string) {
 	materialSymbolsCacheDir = dir
 }
 
 func (p *MaterialSymbolsFontParams) GetIconPath(codePoint string, size int) (*canvas.Path, error) {
 	sizeFloat := float64(size)
-	font := canvas.NewFontFamily("Material Symbols")
-	rawFont, err := p.getFont()
-	if err != nil {
-		return nil, err
-	}
-	err = font.LoadFont(rawFont, 0, canvas.FontRegular)
+	font, err := p.getFontFamily()
 	if err != nil {
 		return nil, err
 	}
 	face := font.Face(mmToPoints(sizeFloat))
 
-	codeInt, err := strconv.ParseInt(codePoint, 16, 32)
+	codeRune, err := ResolveCodePoint(codePoint)
 	if err != nil {
 		return nil, err
 	}
-	codeRune := rune(codeInt)
 	path, _, err := face.ToPath(string(codeRune))
 	if err != nil {
 		return nil, err
@@ -93,14 +89,26 @@ func (p *MaterialSymbolsFontParams) RenderIconCanvas(codePoint string, iconSize,
 }
 
 func (p *MaterialSymbolsFontParams) RenderIcon(codePoint string, iconSize, imgSize, offsetX, offsetY int, iconColor, borderColor, bgColor color.Color, borderWidth int) (*image.RGBA, error) {
+	key := newIconKey(false, p, codePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColor, borderWidth)
+	if img, ok := renderedIcons.get(key); ok {
+		return cloneRGBA(img.(*image.RGBA)), nil
+	}
+
 	c, err := p.RenderIconCanvas(codePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColor, borderWidth)
 	if err != nil {
 		return nil, err
 	}
-	return rasterizer.Draw(c, canvas.DPMM(1.0), canvas.DefaultColorSpace), nil
+	img := rasterizer.Draw(c, canvas.DPMM(1.0), canvas.DefaultColorSpace)
+	renderedIcons.set(key, cloneRGBA(img))
+	return img, nil
 }
 
 func (p *MaterialSymbolsFontParams) RenderIconSVG(codePoint string, iconSize, imgSize, offsetX, offsetY int, iconColor, borderColor, bgColor color.Color, borderWidth int) (string, error) {
+	key := newIconKey(true, p, codePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColor, borderWidth)
+	if svg, ok := renderedIcons.get(key); ok {
+		return svg.(string), nil
+	}
+
 	c, err := p.RenderIconCanvas(codePoint, iconSize, imgSize, offsetX, offsetY, iconColor, borderColor, bgColor, borderWidth)
 	if err != nil {
 		return "", err
@@ -111,6 +119,7 @@ func (p *MaterialSymbolsFontParams) RenderIconSVG(codePoint string, iconSize, im
 	c.RenderTo(svgRenderer)
 	svgRenderer.Close()
 
+	renderedIcons.set(key, buf.String())
 	return buf.String(), nil
 }
 
@@ -136,6 +145,13 @@ func (p *MaterialSymbolsFontParams) String() string {
 	return fmt.Sprintf("%s-%s-%s-%s-%s", p.Style, p.Opsz, p.Wght, p.Fill, p.Grad)
 }
 
+// isDefaultAxes reports whether the params are the default instance of the
+// variable fonts distributed by Google Fonts (opsz 24, wght 400, FILL 0,
+// GRAD 0), which is what a variable font draws without instancing.
+func (p *MaterialSymbolsFontParams) isDefaultAxes() bool {
+	return p.Opsz == "24" && p.Wght == "400" && p.Fill == "0" && p.Grad == "0"
+}
+
 func (p *MaterialSymbolsFontParams) FillEmptyWithDefault() {
 	if p.Style == "" {
 		p.Style = "Outlined"
@@ -235,49 +251,91 @@ func (p *MaterialSymbolsFontParams) fetchWoff2() ([]byte, error) {
 }
 
 func (p *MaterialSymbolsFontParams) getFont() ([]byte, error) {
-	cacheDir := getCacheDir()
-	fontsCachePath := filepath.Join(cacheDir, "materialSymbolsCache.json")
-
-	if materialSymbolsFonts == nil {
-		materialSymbolsFonts = cmap.NewOf[string, []byte]()
-
-		if isFileExist(fontsCachePath) {
-			fontsCacheJson, err := os.ReadFile(fontsCachePath)
-			if err != nil {
-				return nil, err
-			}
-			materialSymbolsFonts.UnmarshalJSON(fontsCacheJson)
-		}
-	}
-
 	if err := p.Assert(); err != nil {
 		return nil, err
 	}
 	p.FillEmptyWithDefault()
 
+	fontData, err := getLocalFont(p)
+	if err == nil {
+		return fontData, nil
+	}
+	if !errors.Is(err, ErrFontNotFound) {
+		return nil, err
+	}
+
 	key := p.String()
 	fontData, ok := materialSymbolsFonts.Get(key)
 	if ok {
 		return fontData, nil
 	}
 
-	fontData, err := p.fetchWoff2()
-	if err != nil {
+	// render goroutines asking for the same new font share one fetch
+	return fetchOnce(key, func() ([]byte, error) {
+		if fontData, ok := materialSymbolsFonts.Get(key); ok {
+			return fontData, nil
+		}
+
+		fontData, err := readCachedFont(key)
+		if err == nil {
+			if err := parseFont(fontData); err == nil {
+				materialSymbolsFonts.Set(key, fontData)
+				return fontData, nil
+			}
+			// the hash matches, but the file was not a font when written
+			log.Printf("error parsing cached font %v: %v\n", key, err)
+			if err := removeCachedFont(key); err != nil {
+				log.Printf("error removing cached font %v: %v\n", key, err)
+			}
+		} else if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("error reading cached font %v: %v\n", key, err)
+		}
+
+		fontData, err = getRemoteFont(p)
+		if err != nil {
+			return nil, err
+		}
+		// an error page or a truncated download must not end up in the cache
+		if err := parseFont(fontData); err != nil {
+			return nil, fmt.Errorf("invalid font %v from the remote source: %w", key, err)
+		}
+		materialSymbolsFonts.Set(key, fontData)
+
+		if err := writeCachedFont(key, fontData); err != nil {
+			log.Printf("error caching font %v: %v\n", key, err)
+		}
+		return fontData, nil
+	})
+}
+
+// getFontFamily returns the parsed font, parsing it on first use.
+func (p *MaterialSymbolsFontParams) getFontFamily() (*canvas.FontFamily, error) {
+	if err := p.Assert(); err != nil {
 		return nil, err
 	}
+	p.FillEmptyWithDefault()
 
-	materialSymbolsFonts.Set(key, fontData)
+	key := p.String()
+	if font, ok := materialSymbolsFamilies.Get(key); ok {
+		return font, nil
+	}
 
-	fontsCacheJson, err := materialSymbolsFonts.MarshalJSON()
+	rawFont, err := p.getFont()
 	if err != nil {
 		return nil, err
 	}
-	err = os.WriteFile(fontsCachePath, fontsCacheJson, 0644)
-	if err != nil {
+	font := canvas.NewFontFamily("Material Symbols")
+	if err := font.LoadFont(rawFont, 0, canvas.FontRegular); err != nil {
 		return nil, err
 	}
+	materialSymbolsFamilies.Set(key, font)
+	return font, nil
+}
 
-	return fontData, nil
+// parseFont reports whether data is a font canvas can draw with.
+func parseFont(data []byte) error {
+	font := canvas.NewFontFamily("Material Symbols")
+	return font.LoadFont(data, 0, canvas.FontRegular)
 }
 
 func isFileExist(p string) bool {
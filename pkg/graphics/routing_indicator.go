@@ -0,0 +1,128 @@
+package graphics
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"sync"
+
+	"github.com/fogleman/gg"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/opentype"
+)
+
+// RoutingIndicator draws rows of labeled chips, e.g. one chip per output bus.
+// Every row is stretched to the full width, so a row with a single chip
+// renders one large chip.
+type RoutingIndicator struct {
+	Width, Height int
+	Background    color.Color
+	ColorFalse    color.Color
+	LabelColor    color.Color
+	Rows          []RoutingIndicatorRow
+	ChipHeight    float64
+	ChipMargin    float64
+	CornerRadius  float64
+	MarginX       float64
+	FontSize      float64
+}
+
+type RoutingIndicatorRow struct {
+	Labels     []string
+	ColorsTrue []color.Color
+}
+
+var (
+	labelFont     *opentype.Font
+	labelFontErr  error
+	labelFontOnce sync.Once
+)
+
+// labelFace returns a new face on every call. A face keeps buffers while
+// drawing and is not safe for concurrent use, so only the parsed font is
+// shared.
+func labelFace(size float64) (font.Face, error) {
+	labelFontOnce.Do(func() {
+		labelFont, labelFontErr = opentype.Parse(gobold.TTF)
+	})
+	if labelFontErr != nil {
+		return nil, labelFontErr
+	}
+
+	return opentype.NewFace(labelFont, &opentype.FaceOptions{
+		Size:    size,
+		DPI:     72,
+		Hinting: font.HintingFull,
+	})
+}
+
+func NewRoutingIndicator() *RoutingIndicator {
+	return &RoutingIndicator{
+		Width:        72,
+		Height:       72,
+		Background:   color.Black,
+		ColorFalse:   color.RGBA{0x2c, 0x3d, 0x4d, 0xff},
+		LabelColor:   color.White,
+		ChipHeight:   16,
+		ChipMargin:   2,
+		CornerRadius: 3,
+		MarginX:      2,
+		FontSize:     9,
+	}
+}
+
+// Render draws the chips vertically centered. flags[row][i] selects whether
+// the chip is drawn with its own color or with ColorFalse.
+func (r *RoutingIndicator) Render(flags [][]bool) (image.Image, error) {
+	if len(flags) > len(r.Rows) {
+		return nil, fmt.Errorf("not enough styles for rows")
+	}
+
+	face, err := labelFace(r.FontSize)
+	if err != nil {
+		return nil, err
+	}
+
+	c := gg.NewContext(r.Width, r.Height)
+	c.SetColor(r.Background)
+	c.Clear()
+	c.SetFontFace(face)
+
+	totalHeight := float64(len(flags))*r.ChipHeight + float64(max(len(flags)-1, 0))*r.ChipMargin
+	y := (float64(r.Height) - totalHeight) / 2
+
+	for row, rowFlags := range flags {
+		style := r.Rows[row]
+		if len(rowFlags) > len(style.Labels) {
+			return nil, fmt.Errorf("not enough labels for row %d", row)
+		}
+		if len(rowFlags) > len(style.ColorsTrue) {
+			return nil, fmt.Errorf("not enough colors for row %d", row)
+		}
+		if len(rowFlags) == 0 {
+			continue
+		}
+
+		n := float64(len(rowFlags))
+		chipWidth := (float64(r.Width) - 2*r.MarginX - (n-1)*r.ChipMargin) / n
+
+		for i, flag := range rowFlags {
+			x := r.MarginX + float64(i)*(chipWidth+r.ChipMargin)
+			if flag {
+				c.SetColor(style.ColorsTrue[i])
+			} else {
+				c.SetColor(r.ColorFalse)
+			}
+			c.DrawRoundedRectangle(x, y, chipWidth, r.ChipHeight, r.CornerRadius)
+			c.Fill()
+
+			c.SetColor(r.LabelColor)
+			c.DrawStringAnchored(style.Labels[i], x+chipWidth/2, y+r.ChipHeight/2, 0.5, 0.35)
+		}
+
+		y += r.ChipHeight + r.ChipMargin
+	}
+
+	return c.Image(), nil
+}
@@ -0,0 +1,254 @@
+// Command genfont writes the fixture font of the tests of package graphics,
+// a TrueType font with a few Material Symbols code points drawn as simple
+// shapes. The tests must not need the real fonts or the network, and the
+// real fonts are too large to keep in the repository.
+//
+//	go run ./pkg/graphics/testdata/genfont pkg/graphics/testdata/MaterialSymbolsOutlined.ttf
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"log"
+	"os"
+	"slices"
+	"sort"
+)
+
+const unitsPerEm = 960 // the same as Material Symbols
+
+type point struct{ x, y int16 }
+
+// glyphs by code point; each is one closed contour
+var glyphs = map[uint16][]point{
+	0xe88a: {{160, 0}, {160, 480}, {80, 480}, {480, 840}, {880, 480}, {800, 480}, {800, 0}}, // home
+	0xe029: {{360, 280}, {360, 800}, {600, 800}, {600, 280}},                                // mic
+	0xe02b: {{200, 120}, {120, 200}, {760, 840}, {840, 760}},                                // mic_off
+	0xe050: {{120, 320}, {120, 640}, {280, 640}, {520, 840}, {520, 120}, {280, 320}},        // volume_up
+	0xe04f: {{120, 320}, {120, 640}, {280, 640}, {520, 840}, {520, 120}},                    // volume_off
+	0xe8b8: {{480, 80}, {80, 480}, {480, 880}, {880, 480}},                                  // settings
+}
+
+func main() {
+	if len(os.Args) != 2 {
+		log.Fatalf("usage: genfont <output.ttf>")
+	}
+
+	codes := []uint16{}
+	for code := range glyphs {
+		codes = append(codes, code)
+	}
+	slices.Sort(codes)
+
+	// glyph 0 is .notdef and has no outline
+	glyf := []byte{}
+	loca := []uint16{0, 0}
+	hmtx := []byte{}
+	hmtx = be(hmtx, uint16(unitsPerEm), int16(0))
+	maxPoints := 0
+	for _, code := range codes {
+		points := glyphs[code]
+		maxPoints = max(maxPoints, len(points))
+		glyf = append(glyf, simpleGlyph(points)...)
+		loca = append(loca, uint16(len(glyf)/2))
+		xMin, _, _, _ := bounds(points)
+		hmtx = be(hmtx, uint16(unitsPerEm), xMin)
+	}
+	numGlyphs := uint16(len(codes) + 1)
+
+	locaData := []byte{}
+	for _, offset := range loca {
+		locaData = be(locaData, offset)
+	}
+
+	head := be(nil,
+		uint32(0x00010000), // version
+		uint32(0x00010000), // fontRevision
+		uint32(0),          // checkSumAdjustment, set below
+		uint32(0x5F0F3CF5), // magicNumber
+		uint16(0x000B),     // flags
+		uint16(unitsPerEm),
+		int64(0), int64(0), // created, modified
+		int16(0), int16(0), int16(unitsPerEm), int16(unitsPerEm), // bounding box
+		uint16(0), // macStyle
+		uint16(8), // lowestRecPPEM
+		int16(2),  // fontDirectionHint
+		int16(0),  // indexToLocFormat: short
+		int16(0),  // glyphDataFormat
+	)
+	hhea := be(nil,
+		uint32(0x00010000),
+		int16(unitsPerEm), int16(0), int16(0), // ascender, descender, lineGap
+		uint16(unitsPerEm),                    // advanceWidthMax
+		int16(0), int16(0), int16(unitsPerEm), // minLeftSideBearing, minRightSideBearing, xMaxExtent
+		int16(1), int16(0), int16(0), // caretSlopeRise, caretSlopeRun, caretOffset
+		int16(0), int16(0), int16(0), int16(0), // reserved
+		int16(0),          // metricDataFormat
+		uint16(numGlyphs), // numberOfHMetrics
+	)
+	maxp := be(nil,
+		uint32(0x00010000),
+		numGlyphs,
+		uint16(maxPoints), uint16(1), // maxPoints, maxContours
+		uint16(0), uint16(0), // maxCompositePoints, maxCompositeContours
+		uint16(2), uint16(0), uint16(0), // maxZones, maxTwilightPoints, maxStorage
+		uint16(0), uint16(0), uint16(0), uint16(0), // maxFunctionDefs, maxInstructionDefs, maxStackElements, maxSizeOfInstructions
+		uint16(0), uint16(0), // maxComponentElements, maxComponentDepth
+	)
+	post := be(nil,
+		uint32(0x00030000),               // no glyph names
+		int32(0), int16(-100), int16(50), // italicAngle, underlinePosition, underlineThickness
+		uint32(0), uint32(0), uint32(0), uint32(0), uint32(0), // isFixedPitch, memory usage
+	)
+
+	data := sfnt(map[string][]byte{
+		"cmap": cmap(codes),
+		"glyf": glyf,
+		"head": head,
+		"hhea": hhea,
+		"hmtx": hmtx,
+		"loca": locaData,
+		"maxp": maxp,
+		"name": name("Material Symbols Outlined Fixture"),
+		"post": post,
+	})
+	if err := os.WriteFile(os.Args[1], data, 0644); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// be appends the values in big endian.
+func be(b []byte, values ...any) []byte {
+	buf := bytes.NewBuffer(b)
+	for _, v := range values {
+		if err := binary.Write(buf, binary.BigEndian, v); err != nil {
+			panic(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func bounds(points []point) (xMin, yMin, xMax, yMax int16) {
+	xMin, yMin, xMax, yMax = points[0].x, points[0].y, points[0].x, points[0].y
+	for _, p := range points[1:] {
+		xMin, yMin = min(xMin, p.x), min(yMin, p.y)
+		xMax, yMax = max(xMax, p.x), max(yMax, p.y)
+	}
+	return
+}
+
+func simpleGlyph(points []point) []byte {
+	xMin, yMin, xMax, yMax := bounds(points)
+	b := be(nil, int16(1), xMin, yMin, xMax, yMax)
+	b = be(b, uint16(len(points)-1), uint16(0)) // endPtsOfContours, instructionLength
+	for range points {
+		b = append(b, 0x01) // on curve, 16-bit coordinates
+	}
+	prev := point{}
+	for _, p := range points {
+		b = be(b, p.x-prev.x)
+		prev.x = p.x
+	}
+	for _, p := range points {
+		b = be(b, p.y-prev.y)
+		prev.y = p.y
+	}
+	// glyphs start at even offsets in a short loca
+	if len(b)%2 != 0 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// cmap maps each code point to its glyph with a format 4 subtable.
+func cmap(codes []uint16) []byte {
+	segCount := len(codes) + 1
+	endCodes := be(nil, codes, uint16(0xFFFF))
+	startCodes := be(nil, codes, uint16(0xFFFF))
+	deltas := []byte{}
+	for i, code := range codes {
+		deltas = be(deltas, uint16(i+1)-code)
+	}
+	deltas = be(deltas, uint16(1))
+	rangeOffsets := make([]byte, 2*segCount)
+
+	searchRange, entrySelector := searchParams(segCount, 2)
+	sub := be(nil,
+		uint16(4),
+		uint16(16+8*segCount), // length
+		uint16(0),             // language
+		uint16(2*segCount),
+		searchRange, entrySelector, uint16(2*segCount)-searchRange,
+	)
+	sub = append(sub, endCodes...)
+	sub = be(sub, uint16(0)) // reservedPad
+	sub = append(sub, startCodes...)
+	sub = append(sub, deltas...)
+	sub = append(sub, rangeOffsets...)
+
+	b := be(nil, uint16(0), uint16(1)) // version, numTables
+	b = be(b, uint16(3), uint16(1), uint32(12))
+	return append(b, sub...)
+}
+
+// name has the family and full name for Windows in English.
+func name(family string) []byte {
+	str := []byte{}
+	for _, r := range family {
+		str = be(str, uint16(r))
+	}
+	ids := []uint16{1, 4}
+	b := be(nil, uint16(0), uint16(len(ids)), uint16(6+12*len(ids)))
+	for _, id := range ids {
+		b = be(b, uint16(3), uint16(1), uint16(0x0409), id, uint16(len(str)), uint16(0))
+	}
+	return append(b, str...)
+}
+
+// searchParams returns searchRange and entrySelector for n items of size.
+func searchParams(n, size int) (uint16, uint16) {
+	entrySelector := 0
+	for 1<<(entrySelector+1) <= n {
+		entrySelector++
+	}
+	return uint16((1 << entrySelector) * size), uint16(entrySelector)
+}
+
+func checksum(b []byte) uint32 {
+	var sum uint32
+	for i := 0; i < len(b); i += 4 {
+		var word [4]byte
+		copy(word[:], b[i:])
+		sum += binary.BigEndian.Uint32(word[:])
+	}
+	return sum
+}
+
+func sfnt(tables map[string][]byte) []byte {
+	tags := []string{}
+	for tag := range tables {
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+
+	searchRange, entrySelector := searchParams(len(tags), 16)
+	b := be(nil, uint32(0x00010000), uint16(len(tags)), searchRange, entrySelector, uint16(16*len(tags))-searchRange)
+
+	offset := uint32(12 + 16*len(tags))
+	body := []byte{}
+	headOffset := uint32(0)
+	for _, tag := range tags {
+		table := tables[tag]
+		if tag == "head" {
+			headOffset = offset
+		}
+		b = append(b, tag...)
+		b = be(b, checksum(table), offset, uint32(len(table)))
+		padded := append(slices.Clone(table), make([]byte, (4-len(table)%4)%4)...)
+		body = append(body, padded...)
+		offset += uint32(len(padded))
+	}
+	b = append(b, body...)
+	binary.BigEndian.PutUint32(b[headOffset+8:], 0xB1B0AFBA-checksum(b))
+	return b
+}
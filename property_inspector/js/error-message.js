@@ -0,0 +1,10 @@
+// Shows the last error the plugin reported for the action in
+// <p id="error-message">. An empty message hides it.
+SDPIComponents.streamDeckClient.sendToPropertyInspector.subscribe((ev) => {
+  if (ev.payload?.event !== "showError") {
+    return;
+  }
+  const box = document.getElementById("error-message");
+  box.textContent = ev.payload.message;
+  box.hidden = !ev.payload.message;
+});
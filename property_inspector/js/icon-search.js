@@ -0,0 +1,96 @@
+// Icon search of the property inspectors. Include this after the locales are
+// set and put <icon-search></icon-search> where the search goes. The plugin
+// answers the search with matching names and previews. Picking one fills the
+// icon field focused last, or the first one; without an icon field, the name
+// is copied.
+(() => {
+  const messages = {
+    en: {
+      textfield_iconSearch_label: "Search Icons",
+      textfield_iconSearch_placeholder: "Enter part of a name",
+      textfield_iconSearch_description: "Click an icon to use it.",
+    },
+    ja: {
+      textfield_iconSearch_label: "アイコン検索",
+      textfield_iconSearch_placeholder: "名前の一部を入力",
+      textfield_iconSearch_description: "アイコンをクリックすると設定します。",
+    },
+  };
+  const locales = SDPIComponents.i18n.locales;
+  for (const [language, defaults] of Object.entries(messages)) {
+    // messages of the page come first
+    locales[language] = { ...defaults, ...locales[language] };
+  }
+
+  const iconFieldSelector = 'sdpi-textfield[setting^="iconCodePoint"]';
+  let iconField = null;
+  let iconQuery = "";
+  let results = null;
+
+  document.addEventListener("focusin", (ev) => {
+    const field = ev.target.closest?.(iconFieldSelector);
+    if (field) {
+      iconField = field;
+    }
+  });
+
+  const searchIcons = async (ev) => {
+    iconQuery = ev.composedPath()[0].value ?? "";
+    const payload = { event: "searchIcons", query: iconQuery };
+    await SDPIComponents.streamDeckClient.send("sendToPlugin", payload);
+  };
+
+  const pickIcon = (name) => {
+    const field = iconField ?? document.querySelector(iconFieldSelector);
+    const input = field?.shadowRoot?.querySelector("input");
+    if (!input) {
+      navigator.clipboard?.writeText(name);
+      return;
+    }
+    input.value = name;
+    input.dispatchEvent(new Event("input", { bubbles: true, composed: true }));
+    input.dispatchEvent(new Event("change", { bubbles: true, composed: true }));
+  };
+
+  SDPIComponents.streamDeckClient.sendToPropertyInspector.subscribe((ev) => {
+    if (ev.payload?.event !== "searchIcons" || ev.payload.query !== iconQuery) {
+      return;
+    }
+    const buttons = ev.payload.items.map((item) => {
+      const button = document.createElement("button");
+      button.title = item.name;
+      button.innerHTML = item.svg ?? "";
+      const label = document.createElement("span");
+      label.textContent = item.name;
+      button.append(label);
+      button.onclick = () => pickIcon(item.name);
+      return button;
+    });
+    results?.replaceChildren(...buttons);
+  });
+
+  customElements.define(
+    "icon-search",
+    class extends HTMLElement {
+      connectedCallback() {
+        if (results) {
+          return;
+        }
+        this.innerHTML = `
+          <sdpi-item label="__MSG_textfield_iconSearch_label__">
+            <sdpi-textfield
+              placeholder="__MSG_textfield_iconSearch_placeholder__"
+            ></sdpi-textfield>
+          </sdpi-item>
+
+          <sdpi-item>
+            <p><sdpi-i18n key="textfield_iconSearch_description"></sdpi-i18n></p>
+            <div class="icon-search-results"></div>
+          </sdpi-item>
+        `;
+        this.querySelector("sdpi-textfield").addEventListener("input", searchIcons);
+        results = this.querySelector(".icon-search-results");
+      }
+    },
+  );
+})();